@@ -3,6 +3,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -10,22 +14,30 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
 )
 
-func InvalidateCache(bucketName string, client *cloudfront.Client, ctx context.Context) (*cloudfront.CreateInvalidationOutput, error) {
-	// get distribution id
-	distributionID, err := getDistributionID(bucketName, client, ctx)
+const (
+	// MaxInvalidationPaths is the most paths CloudFront accepts in one invalidation batch.
+	MaxInvalidationPaths = 3000
 
-	if err != nil {
-		return nil, err
+	DefaultInvalidationThreshold = 50
+
+	invalidationWaitTimeout = 30 * time.Minute
+)
+
+// CreateInvalidation invalidates paths on the distribution. Invalidating everything takes
+// an explicit "/*", no paths are an error rather than a flush of the whole distribution.
+func CreateInvalidation(distributionID string, paths []string, client CloudFrontAPI, ctx context.Context) (*cloudfront.CreateInvalidationOutput, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no paths to invalidate on distribution %s", distributionID)
 	}
 
 	// create invalidation
 	invalidation := &cloudfront.CreateInvalidationInput{
 		DistributionId: aws.String(distributionID),
 		InvalidationBatch: &types.InvalidationBatch{
-			CallerReference: aws.String(fmt.Sprintf("%d", time.Now().Unix())),
+			CallerReference: aws.String(fmt.Sprintf("%d", time.Now().UnixNano())),
 			Paths: &types.Paths{
-				Quantity: aws.Int32(1),
-				Items:    []string{"/*"},
+				Quantity: aws.Int32(int32(len(paths))),
+				Items:    paths,
 			},
 		},
 	}
@@ -33,21 +45,249 @@ func InvalidateCache(bucketName string, client *cloudfront.Client, ctx context.C
 	return client.CreateInvalidation(ctx, invalidation)
 }
 
-func getDistributionID(bucketName string, client *cloudfront.Client, ctx context.Context) (string, error) {
-	// get distribution id
-	distributionList, err := client.ListDistributions(ctx, &cloudfront.ListDistributionsInput{})
+// WaitForInvalidation blocks until the invalidation reaches the Completed status.
+func WaitForInvalidation(distributionID string, output *cloudfront.CreateInvalidationOutput, client CloudFrontAPI, ctx context.Context) error {
+	waiter := cloudfront.NewInvalidationCompletedWaiter(client)
+
+	err := waiter.Wait(ctx, &cloudfront.GetInvalidationInput{
+		DistributionId: aws.String(distributionID),
+		Id:             output.Invalidation.Id,
+	}, invalidationWaitTimeout)
 
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	emit(&InvalidationEvent{
+		DistributionID: distributionID,
+		InvalidationID: aws.ToString(output.Invalidation.Id),
+		Status:         InvalidationCompleted,
+	})
+
+	return nil
+}
+
+// InvalidationPaths turns changed object keys into CloudFront paths. Index pages also
+// invalidate their directory path. Once there are more paths than threshold (or the
+// CloudFront batch limit) they are collapsed into a wildcard per top-level directory
+// under prefix, and if that is still too many, into a single wildcard for the prefix.
+func InvalidationPaths(keys []string, prefix string, threshold int) []string {
+	if threshold <= 0 || threshold > MaxInvalidationPaths {
+		threshold = MaxInvalidationPaths
+	}
+
+	paths := map[string]bool{}
+
+	for _, key := range keys {
+		paths["/"+key] = true
+
+		if path.Base(key) == "index.html" {
+			dir := path.Dir(key)
+
+			if dir == "." {
+				paths["/"] = true
+			} else {
+				paths["/"+dir+"/"] = true
+			}
+		}
+	}
+
+	if len(paths) <= threshold {
+		return sortedPaths(paths)
+	}
+
+	root := "/" + listPrefix(prefix)
+	collapsed := map[string]bool{}
+
+	for _, key := range keys {
+		rel := strings.TrimPrefix(key, listPrefix(prefix))
+
+		if i := strings.Index(rel, "/"); i >= 0 {
+			collapsed[root+rel[:i]+"/*"] = true
+		} else {
+			collapsed["/"+key] = true
+		}
+	}
+
+	if paths[root] {
+		collapsed[root] = true
+	}
+
+	if len(collapsed) <= threshold {
+		return sortedPaths(collapsed)
+	}
+
+	return []string{root + "*"}
+}
+
+// DistributionPaths is InvalidationPaths for a distribution serving the bucket from
+// originPath: it serves <originPath>/about at /about, and keys outside of originPath
+// aren't served by it at all.
+func DistributionPaths(keys []string, prefix, originPath string, threshold int) []string {
+	root := listPrefix(strings.Trim(originPath, "/"))
+
+	if root == "" {
+		return InvalidationPaths(keys, prefix, threshold)
+	}
+
+	served := []string{}
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, root) {
+			served = append(served, strings.TrimPrefix(key, root))
+		}
+	}
+
+	return InvalidationPaths(served, strings.TrimPrefix(listPrefix(prefix), root), threshold)
+}
+
+func sortedPaths(paths map[string]bool) []string {
+	sorted := make([]string, 0, len(paths))
+
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// ResolveDistributionID returns the configured distribution ID, looking it up only when none was given,
+// along with the origin path the distribution serves the bucket from.
+func ResolveDistributionID(userInput *Config, client CloudFrontAPI, ctx context.Context) (string, string, error) {
+	if userInput.DistributionID == "" {
+		return getDistributionID(userInput.Bucket, userInput.Prefix, client, ctx)
 	}
 
-	expectedDomainName := fmt.Sprintf("%s.s3.%s.amazonaws.com", bucketName, client.Options().Region)
+	output, err := client.GetDistributionConfig(ctx, &cloudfront.GetDistributionConfigInput{
+		Id: aws.String(userInput.DistributionID),
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	origins := output.DistributionConfig.Origins
+
+	if originPath, ok := bucketOriginPath(origins, userInput.Bucket, userInput.Prefix); ok {
+		return userInput.DistributionID, originPath, nil
+	}
+
+	// the bucket may be served from a path outside of the prefix, which then serves none of its keys
+	for _, origin := range origins.Items {
+		if isBucketOrigin(aws.ToString(origin.DomainName), userInput.Bucket) {
+			return userInput.DistributionID, "/" + strings.Trim(aws.ToString(origin.OriginPath), "/"), nil
+		}
+	}
+
+	// a distribution without an origin in the bucket is invalidated relative to the bucket root
+	return userInput.DistributionID, "", nil
+}
+
+// s3OriginDomain matches what follows "<bucket>." in every S3 origin domain form: the legacy
+// global endpoint, regional (dot or dash), dualstack, website endpoints and the China partition.
+var s3OriginDomain = regexp.MustCompile(`^s3(-website)?([.-][a-z0-9-]+)*\.amazonaws\.com(\.cn)?$`)
+
+func isBucketOrigin(domainName, bucketName string) bool {
+	domainName = strings.ToLower(domainName)
+	bucketDomain := strings.ToLower(bucketName) + "."
+
+	if !strings.HasPrefix(domainName, bucketDomain) {
+		return false
+	}
+
+	return s3OriginDomain.MatchString(domainName[len(bucketDomain):])
+}
+
+// bucketOriginPath returns the origin path ("/docs", or "" for the whole bucket) the origins
+// serve the bucket from, preferring an origin path serving prefix over the whole bucket. ok
+// is false when no origin serves the bucket at either.
+func bucketOriginPath(origins *types.Origins, bucketName, prefix string) (string, bool) {
+	if origins == nil {
+		return "", false
+	}
+
+	whole := false
+
+	for _, origin := range origins.Items {
+		if !isBucketOrigin(aws.ToString(origin.DomainName), bucketName) {
+			continue
+		}
+
+		path := "/" + strings.Trim(aws.ToString(origin.OriginPath), "/")
+
+		if path != "/" && servesPrefix(path, prefix) {
+			return path, true
+		}
+
+		if path == "/" {
+			whole = true
+		}
+	}
+
+	return "", whole
+}
+
+// distributionMatch is a distribution serving the bucket from originPath.
+type distributionMatch struct {
+	id         string
+	originPath string
+}
+
+func getDistributionID(bucketName, prefix string, client CloudFrontAPI, ctx context.Context) (string, string, error) {
+	// distributions whose origin path is the prefix (or one of its releases) are preferred
+	// over ones serving the whole bucket
+	var exact, whole []distributionMatch
+
+	input := &cloudfront.ListDistributionsInput{}
+
+	for {
+		distributionList, err := client.ListDistributions(ctx, input)
+
+		if err != nil {
+			return "", "", err
+		}
+
+		for _, distribution := range distributionList.DistributionList.Items {
+			path, ok := bucketOriginPath(distribution.Origins, bucketName, prefix)
+
+			switch {
+			case !ok:
+				continue
+			case path != "":
+				exact = append(exact, distributionMatch{*distribution.Id, path})
+			default:
+				whole = append(whole, distributionMatch{id: *distribution.Id})
+			}
+		}
+
+		if !aws.ToBool(distributionList.DistributionList.IsTruncated) {
+			break
+		}
+
+		input.Marker = distributionList.DistributionList.NextMarker
+	}
+
+	for _, matches := range [][]distributionMatch{exact, whole} {
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return matches[0].id, matches[0].originPath, nil
+		default:
+			ids := make([]string, len(matches))
+
+			for i, match := range matches {
+				ids[i] = match.id
+			}
 
-	for _, distribution := range distributionList.DistributionList.Items {
-		if *distribution.Origins.Items[0].DomainName == expectedDomainName {
-			return *distribution.Id, nil
+			return "", "", fmt.Errorf(
+				"found %d distributions for bucket %s (%s), use --distribution-id to pick one",
+				len(matches), bucketName, strings.Join(ids, ", "),
+			)
 		}
 	}
 
-	return "", fmt.Errorf("distribution for bucket %s not found", bucketName)
+	return "", "", fmt.Errorf("distribution for bucket %s not found", bucketName)
 }
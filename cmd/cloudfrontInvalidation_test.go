@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestInvalidationPaths(t *testing.T) {
+	tests := []struct {
+		keys      []string
+		prefix    string
+		threshold int
+		expected  []string
+	}{
+		{[]string{"about", "blog/index.html"}, "", 10, []string{"/about", "/blog/", "/blog/index.html"}},
+		{[]string{"docs/index.html"}, "docs", 10, []string{"/docs/", "/docs/index.html"}},
+		{[]string{"a/1", "a/2", "b/1", "index.html"}, "", 4, []string{"/", "/a/*", "/b/*", "/index.html"}},
+		{[]string{"docs/a/1", "docs/a/2", "docs/b"}, "docs", 2, []string{"/docs/a/*", "/docs/b"}},
+		{[]string{"a/1", "b/1", "c/1"}, "", 2, []string{"/*"}},
+		{[]string{"docs/a/1", "docs/b/1", "docs/c/1"}, "docs/", 2, []string{"/docs/*"}},
+	}
+
+	for _, test := range tests {
+		if paths := InvalidationPaths(test.keys, test.prefix, test.threshold); !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, paths)
+		}
+	}
+}
+
+func TestDistributionPaths(t *testing.T) {
+	tests := []struct {
+		keys       []string
+		prefix     string
+		originPath string
+		threshold  int
+		expected   []string
+	}{
+		{[]string{"docs/index.html"}, "docs", "", 10, []string{"/docs/", "/docs/index.html"}},
+		{[]string{"docs/index.html", "docs/about"}, "docs", "/docs", 10, []string{"/", "/about", "/index.html"}},
+		{[]string{"docs/a/1", "docs/b/1", "docs/c/1"}, "docs", "/docs/", 2, []string{"/*"}},
+		{[]string{"docs/v2/a", "docs/b"}, "docs", "/docs/v2", 10, []string{"/a"}},
+		{[]string{"other/x"}, "other", "/docs", 50, []string{}},
+	}
+
+	for _, test := range tests {
+		paths := DistributionPaths(test.keys, test.prefix, test.originPath, test.threshold)
+
+		if !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("origin path %q: expected %v, got %v", test.originPath, test.expected, paths)
+		}
+	}
+}
+
+func TestIsBucketOrigin(t *testing.T) {
+	tests := []struct {
+		domainName string
+		expected   bool
+	}{
+		{"site.s3.amazonaws.com", true},
+		{"site.s3.us-west-2.amazonaws.com", true},
+		{"site.s3-us-west-2.amazonaws.com", true},
+		{"site.s3-website-us-east-1.amazonaws.com", true},
+		{"site.s3-website.eu-central-1.amazonaws.com", true},
+		{"site.s3.dualstack.us-east-1.amazonaws.com", true},
+		{"site.s3.cn-north-1.amazonaws.com.cn", true},
+		{"other-site.s3.amazonaws.com", false},
+		{"site.example.com", false},
+		{"site.s3.amazonaws.com.example.com", false},
+	}
+
+	for _, test := range tests {
+		if got := isBucketOrigin(test.domainName, "site"); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.domainName, test.expected, got)
+		}
+	}
+}
+
+func TestGetDistributionID(t *testing.T) {
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "OTHER", Origins: []fakeaws.Origin{{DomainName: "other.s3.amazonaws.com"}}},
+		fakeaws.Distribution{ID: "WHOLE", Origins: []fakeaws.Origin{
+			{DomainName: "api.example.com"},
+			{DomainName: "site.s3.amazonaws.com"},
+		}},
+		fakeaws.Distribution{ID: "DOCS", Origins: []fakeaws.Origin{{DomainName: "site.s3-website-us-east-1.amazonaws.com", OriginPath: "/docs"}}},
+		fakeaws.Distribution{ID: "BLOG1", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com", OriginPath: "/blog"}}},
+		fakeaws.Distribution{ID: "BLOG2", Origins: []fakeaws.Origin{{DomainName: "site.s3.amazonaws.com", OriginPath: "/blog/"}}},
+	)
+	distributions.PageSize = 2
+
+	tests := []struct {
+		prefix             string
+		expected           string
+		expectedOriginPath string
+		expectedError      bool
+	}{
+		{"", "WHOLE", "", false},
+		{"docs", "DOCS", "/docs", false},
+		{"assets", "WHOLE", "", false},
+		{"blog", "", "", true},
+	}
+
+	for _, test := range tests {
+		id, originPath, err := getDistributionID("site", test.prefix, distributions, context.Background())
+
+		if test.expectedError != (err != nil) || id != test.expected {
+			t.Errorf("prefix %q: expected %q (error %v), got %q (%v)", test.prefix, test.expected, test.expectedError, id, err)
+		}
+
+		if originPath != test.expectedOriginPath {
+			t.Errorf("prefix %q: expected origin path %q, got %q", test.prefix, test.expectedOriginPath, originPath)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// DefaultCompressTypes are the MIME types compressed when no types are given.
+var DefaultCompressTypes = []string{
+	"text/html",
+	"text/css",
+	"text/javascript",
+	"text/plain",
+	"text/xml",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+// CompressOptions configures pre-compressing files before upload. Types are MIME types
+// (as returned by getObjectKeyType, without parameters) or file extensions like ".wasm".
+type CompressOptions struct {
+	Encoding string
+	Types    []string
+}
+
+func ValidateEncoding(encoding string) error {
+	switch encoding {
+	case "", EncodingGzip, EncodingBrotli:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression %q, use %s or %s", encoding, EncodingGzip, EncodingBrotli)
+	}
+}
+
+func (options CompressOptions) matches(file LocalFile) bool {
+	mimeType, _, _ := strings.Cut(file.MimeType, ";")
+	ext := strings.ToLower(filepath.Ext(file.Name))
+
+	for _, t := range options.Types {
+		if strings.EqualFold(t, strings.TrimSpace(mimeType)) || strings.EqualFold(t, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func encodingExtension(encoding string) string {
+	if encoding == EncodingGzip {
+		return ".gz"
+	}
+
+	return "." + encoding
+}
+
+// applyCompression marks files matching options for compression. A matching file with a
+// sibling that a bundler already compressed (app.js.gz next to app.js) is uploaded from
+// that sibling instead, and the sibling is not uploaded under its own key.
+func applyCompression(files []LocalFile, options CompressOptions) []LocalFile {
+	if options.Encoding == "" {
+		return files
+	}
+
+	ext := encodingExtension(options.Encoding)
+	byName := map[string]int{}
+
+	for i, file := range files {
+		byName[file.Name] = i
+	}
+
+	consumed := map[string]bool{}
+
+	for i := range files {
+		file := &files[i]
+
+		// files of other types, like data.tar next to data.tar.gz, are served as they are
+		if !options.matches(*file) {
+			continue
+		}
+
+		file.ContentEncoding = options.Encoding
+
+		if sibling, exists := byName[file.Name+ext]; exists {
+			consumed[files[sibling].Name] = true
+			file.Path = files[sibling].Path
+			file.Size = files[sibling].Size
+			continue
+		}
+
+		file.Compress = true
+	}
+
+	result := files[:0]
+
+	for _, file := range files {
+		if !consumed[file.Name] {
+			result = append(result, file)
+		}
+	}
+
+	return result
+}
+
+func newCompressor(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case EncodingBrotli:
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	default:
+		return nil, ValidateEncoding(encoding)
+	}
+}
+
+// compressFile returns the compressed contents of path. The output only depends on
+// the input, so its MD5 matches the ETag of a previous upload of the same file.
+func compressFile(path, encoding string) ([]byte, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var buf bytes.Buffer
+
+	compressor, err := newCompressor(&buf, encoding)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(compressor, file); err != nil {
+		return nil, err
+	}
+
+	if err = compressor.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
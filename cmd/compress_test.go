@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestApplyCompression(t *testing.T) {
+	files := []LocalFile{
+		{Name: "index.html", Path: "index.html", MimeType: "text/html; charset=utf-8"},
+		{Name: "app.js", Path: "app.js", MimeType: "text/javascript; charset=utf-8"},
+		{Name: "app.js.gz", Path: "app.js.gz", MimeType: "application/gzip"},
+		{Name: "logo.png", Path: "logo.png", MimeType: "image/png"},
+		{Name: "module.wasm", Path: "module.wasm", MimeType: "application/wasm"},
+		{Name: "archive.tar.gz", Path: "archive.tar.gz", MimeType: "application/gzip"},
+		{Name: "data.tar", Path: "data.tar", MimeType: "application/x-tar"},
+		{Name: "data.tar.gz", Path: "data.tar.gz", MimeType: "application/gzip"},
+	}
+
+	result := applyCompression(files, CompressOptions{
+		Encoding: EncodingGzip,
+		Types:    []string{"text/html", "text/javascript", ".wasm"},
+	})
+
+	expected := []LocalFile{
+		{Name: "index.html", Path: "index.html", MimeType: "text/html; charset=utf-8", ContentEncoding: "gzip", Compress: true},
+		{Name: "app.js", Path: "app.js.gz", MimeType: "text/javascript; charset=utf-8", ContentEncoding: "gzip"},
+		{Name: "logo.png", Path: "logo.png", MimeType: "image/png"},
+		{Name: "module.wasm", Path: "module.wasm", MimeType: "application/wasm", ContentEncoding: "gzip", Compress: true},
+		{Name: "archive.tar.gz", Path: "archive.tar.gz", MimeType: "application/gzip"},
+		// data.tar does not match the types, so both downloads keep their own body
+		{Name: "data.tar", Path: "data.tar", MimeType: "application/x-tar"},
+		{Name: "data.tar.gz", Path: "data.tar.gz", MimeType: "application/gzip"},
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+}
+
+func TestPutLocalFileReusesCompressedBody(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "<h1>home</h1>"})
+	file := LocalFile{Path: filepath.Join(dir, "index.html"), Key: "index.html", ContentEncoding: EncodingGzip, Compress: true}
+
+	if err := file.computeETag(MultipartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file changed after its ETag was computed, the upload still sends the body it describes
+	if err := os.WriteFile(file.Path, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := fakeaws.NewBucket("site")
+
+	if _, err := putLocalFile(file, "site", UploadOptions{}, bucket, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if etag := bucket.Get("index.html").ETag; etag != file.ETag {
+		t.Errorf("expected the body compressed for the ETag %s to be uploaded, got %s", file.ETag, etag)
+	}
+}
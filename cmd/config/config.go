@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"strings"
 
 	"github.com/alrudolph/snyc-static-site-s3/cmd"
 	"github.com/spf13/cobra"
@@ -28,49 +30,146 @@ var configCmd = &cobra.Command{
 	// Example Usage:
 	// 	go run . --directory /path/to/static/site --bucket s3-bucket-name
 	// `,
-	Run: func(command *cobra.Command, args []string) {
-		if len(args) > 0 {
-			fmt.Println("Additional supplied args will be ignored")
-		}
+	RunE: listConfigs,
+}
 
-		options, err := cmd.LoadConfigOptions()
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the environments and saved profiles for this directory",
+	RunE:  listConfigs,
+}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+// listConfigs prints the environments of the project file and the profiles saved for
+// the working directory.
+func listConfigs(command *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		fmt.Println("Additional supplied args will be ignored")
+	}
 
-		if len(options) == 0 {
-			log.Fatal("No saved configurations found")
-		}
+	project, err := cmd.LoadProjectFile(".")
 
-		for _, option := range options {
-			fmt.Println(option.Name)
+	if err != nil {
+		return err
+	}
 
-			fmt.Println("    bucket: ", option.Bucket)
-			fmt.Println("    region: ", option.Region)
-			fmt.Println("    directory: ", option.Directory)
+	if project != nil {
+		printProject(project)
+	}
+
+	options, err := cmd.LoadConfigOptions()
 
-			if option.Profile != "" {
-				fmt.Println("    profile: ", option.Profile)
-			}
+	// environments of the project file are enough to deploy with
+	if err != nil && (project == nil || !errors.Is(err, cmd.ErrConfigNotFound)) {
+		return err
+	}
 
-			if option.Role != "" {
-				fmt.Println("    role: ", option.Role)
-			}
+	if len(options) == 0 && project == nil {
+		return fmt.Errorf("%w: no saved configurations for this directory", cmd.ErrConfigNotFound)
+	}
 
-			if option.AccessKeyID != "" {
-				fmt.Println("    access key id: ", starOutWord(option.AccessKeyID, 3))
-			}
+	for _, option := range options {
+		printProfile(option)
+	}
 
-			if option.SecretAccessKey != "" {
-				fmt.Println("    secret access key: ", starOutWord(option.SecretAccessKey, 3))
-			}
+	return nil
+}
+
+func printProfile(option cmd.SavedConfig) {
+	fmt.Println(option.Name)
+
+	fmt.Println("    bucket: ", option.Bucket)
+	fmt.Println("    region: ", option.Region)
+	fmt.Println("    directory: ", option.Directory)
+
+	if option.Profile != "" {
+		fmt.Println("    profile: ", option.Profile)
+	}
+
+	if option.Role != "" {
+		fmt.Println("    role: ", option.Role)
+	}
+
+	if option.DistributionID != "" {
+		fmt.Println("    distribution id: ", option.DistributionID)
+	}
+
+	if option.HTMLKeys != "" {
+		fmt.Println("    html keys: ", option.HTMLKeys)
+	}
+
+	if len(option.HTMLExempt) > 0 {
+		fmt.Println("    html exempt: ", strings.Join(option.HTMLExempt, ", "))
+	}
 
-			fmt.Println()
+	for _, pattern := range option.Preserve {
+		fmt.Println("    preserve: ", pattern)
+	}
+
+	for _, header := range option.Headers {
+		fmt.Println("    header: ", header.String())
+	}
+
+	if option.AccessKeyID != "" {
+		fmt.Println("    access key id: ", starOutWord(option.AccessKeyID, 3))
+	}
+
+	if option.SecretAccessKey != "" {
+		fmt.Println("    secret access key: ", starOutWord(option.SecretAccessKey, 3))
+	}
+
+	if option.SecretRef != "" {
+		backend, _, _ := strings.Cut(option.SecretRef, ":")
+		fmt.Println("    secrets: ", backend)
+	} else if option.AccessKeyID != "" || option.SecretAccessKey != "" {
+		fmt.Println("    secrets:  plaintext, move them with config migrate-secrets")
+	}
+
+	fmt.Println()
+}
+
+func printProject(project *cmd.ProjectFile) {
+	fmt.Printf("Environments in %s:\n\n", project.Path)
+
+	names := make([]string, 0, len(project.Environments))
+
+	for name := range project.Environments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		printEnvironment(name, project.Environments[name])
+	}
+}
+
+func printEnvironment(name string, env cmd.ProjectEnvironment) {
+	fmt.Println(name)
+	fmt.Println("    bucket: ", env.Bucket)
+
+	for _, field := range []struct{ name, value string }{
+		{"prefix", env.Prefix},
+		{"region", env.Region},
+		{"directory", env.Directory},
+		{"profile", env.Profile},
+		{"role", env.Role},
+		{"distribution id", env.DistributionID},
+		{"html keys", env.HTMLKeys},
+		{"compress", env.Compress},
+	} {
+		if field.value != "" {
+			fmt.Printf("    %s:  %s\n", field.name, field.value)
 		}
-	},
+	}
+
+	for _, header := range env.Headers {
+		fmt.Println("    header: ", header)
+	}
+
+	fmt.Println()
 }
 
 func init() {
+	configCmd.AddCommand(listCmd)
 	cmd.RootCmd.AddCommand(configCmd)
 }
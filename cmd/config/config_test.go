@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/pflag"
+)
+
+// memoryBackend keeps secrets in a map. onDelete, when set, runs before a secret is deleted.
+type memoryBackend struct {
+	secrets  map[string]string
+	onDelete func(key string)
+}
+
+func (backend *memoryBackend) Name() string {
+	return "memory"
+}
+
+func (backend *memoryBackend) Get(key string) (string, error) {
+	value, ok := backend.secrets[key]
+
+	if !ok {
+		return "", errors.New("no such secret")
+	}
+
+	return value, nil
+}
+
+func (backend *memoryBackend) Set(key, value string) error {
+	backend.secrets[key] = value
+	return nil
+}
+
+func (backend *memoryBackend) Delete(key string) error {
+	if backend.onDelete != nil {
+		backend.onDelete(key)
+	}
+
+	delete(backend.secrets, key)
+	return nil
+}
+
+var memory = &memoryBackend{}
+
+func init() {
+	cmd.RegisterSecretBackend("memory", func() (cmd.SecretBackend, error) { return memory, nil })
+}
+
+// useMemoryBackend empties the in-memory secret backend for a test.
+func useMemoryBackend(t *testing.T) *memoryBackend {
+	t.Helper()
+
+	memory.secrets = map[string]string{}
+	memory.onDelete = nil
+
+	return memory
+}
+
+// useConfigFile points the saved profiles at a temporary file and runs the test from a
+// temporary working directory, which it returns.
+func useConfigFile(t *testing.T) (*cmd.ProfileStore, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sync-s3", "config.json")
+	original := cmd.ConfigFilePath
+	cmd.ConfigFilePath = func() (string, error) { return path, nil }
+	t.Cleanup(func() { cmd.ConfigFilePath = original })
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+
+	dir, err := filepath.Abs(".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := cmd.NewProfileStore()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store, dir
+}
+
+// keyProfile is a profile that signs in with access keys.
+func keyProfile(name string) cmd.SavedConfig {
+	return cmd.SavedConfig{Name: name, Bucket: name + "-site", Region: "us-east-1", AccessKeyID: "AKIA" + name, SecretAccessKey: "secret"}
+}
+
+// saveProfiles stores profiles for dir, moving access keys into the memory backend.
+func saveProfiles(t *testing.T, store *cmd.ProfileStore, dir string, profiles ...cmd.SavedConfig) {
+	t.Helper()
+
+	for _, profile := range profiles {
+		profile.UserDirectory = dir
+
+		if err := store.Add(profile, memory); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// loadProfile returns the profile saved as name for dir, or nil.
+func loadProfile(t *testing.T, store *cmd.ProfileStore, dir, name string) *cmd.SavedConfig {
+	t.Helper()
+
+	file, err := store.Load()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i := file.Find(name, dir); i >= 0 {
+		return &file.Profiles[i]
+	}
+
+	return nil
+}
+
+// runConfig runs the config command with args, resetting the flags of earlier runs.
+func runConfig(args ...string) error {
+	for _, command := range configCmd.Commands() {
+		command.Flags().VisitAll(func(flag *pflag.Flag) {
+			if slice, ok := flag.Value.(pflag.SliceValue); ok {
+				var values []string
+
+				if defaults := strings.Trim(flag.DefValue, "[]"); defaults != "" {
+					values = strings.Split(defaults, ",")
+				}
+
+				_ = slice.Replace(values)
+			} else {
+				_ = flag.Value.Set(flag.DefValue)
+			}
+			flag.Changed = false
+		})
+	}
+
+	cmd.RootCmd.SetArgs(append([]string{"config"}, args...))
+
+	return cmd.RootCmd.Execute()
+}
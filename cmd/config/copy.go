@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy <name> --to-dir <directory>",
+	Short: "Copy a profile saved for this directory to another directory",
+	Long: `Saves a copy of the profile for another directory, for example a second clone of the
+same project. The site directory of the profile is copied as is, so a relative directory points
+at the same place within the other clone. Use --name to save the copy under another name.
+
+Example Usage:
+	go run . config copy production --to-dir ../site-hotfix
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(command *cobra.Command, args []string) error {
+		name := args[0]
+		toDir, _ := command.Flags().GetString("to-dir")
+		newName, _ := command.Flags().GetString("name")
+
+		if newName == "" {
+			newName = name
+		}
+
+		userDirectory, err := filepath.Abs(toDir)
+
+		if err != nil {
+			return err
+		}
+
+		store, err := cmd.NewProfileStore()
+
+		if err != nil {
+			return err
+		}
+
+		err = store.Update(func(file *cmd.SavedConfigFile) error {
+			i, err := file.Profile(name)
+
+			if err != nil {
+				return err
+			}
+
+			if file.Find(newName, userDirectory) >= 0 {
+				return fmt.Errorf("profile %s already exists for %s", newName, userDirectory)
+			}
+
+			profile := file.Profiles[i]
+			profile.Name = newName
+			profile.UserDirectory = userDirectory
+			file.Profiles = append(file.Profiles, profile)
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Copied profile %s to %s as %s\n", name, userDirectory, newName)
+
+		return nil
+	},
+}
+
+func init() {
+	copyCmd.Flags().String("to-dir", "", "Directory to save the copy for")
+	_ = copyCmd.MarkFlagDirname("to-dir")
+	_ = copyCmd.MarkFlagRequired("to-dir")
+	copyCmd.Flags().String("name", "", "Name of the copy, defaults to the name of the profile")
+
+	configCmd.AddCommand(copyCmd)
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	store, dir := useConfigFile(t)
+	useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"))
+
+	other := filepath.Join(dir, "clone")
+
+	if err := runConfig("copy", "production", "--to-dir", other); err != nil {
+		t.Fatal(err)
+	}
+
+	original := loadProfile(t, store, dir, "production")
+	copied := loadProfile(t, store, other, "production")
+
+	if copied == nil || copied.Bucket != original.Bucket || copied.SecretRef != original.SecretRef {
+		t.Errorf("expected a copy of %+v for %s, got %+v", original, other, copied)
+	}
+
+	if err := runConfig("copy", "production", "--to-dir", other); err == nil {
+		t.Errorf("expected copying onto an existing profile to fail")
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Change fields of a profile saved for this directory",
+	Long: `Updates only the fields passed as flags, everything else in the profile is kept.
+Passing --header or --preserve replaces the whole list. New access keys are stored in the
+profile's secret backend, or the one given by --secret-backend, and replace the AWS profile.
+Passing --profile removes the saved access keys.
+
+Example Usage:
+	go run . config edit production --bucket new-bucket --region us-west-2
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(command *cobra.Command, args []string) error {
+		store, err := cmd.NewProfileStore()
+
+		if err != nil {
+			return err
+		}
+
+		if err = unlockEditSecrets(command, store, args[0]); err != nil {
+			return err
+		}
+
+		keysChanged := command.Flags().Changed("access-key-id") || command.Flags().Changed("secret-access-key")
+
+		if keysChanged && command.Flags().Changed("profile") {
+			return errors.New("cannot provide both --profile and access keys")
+		}
+
+		var unused string
+
+		err = store.Update(func(file *cmd.SavedConfigFile) error {
+			i, err := file.Profile(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			profile := &file.Profiles[i]
+			oldRef := profile.SecretRef
+
+			// the backend holds both keys, so load them before changing one
+			if keysChanged {
+				if err = cmd.ResolveSecrets(profile); err != nil {
+					return err
+				}
+			}
+
+			if err = applyEditFlags(command, profile); err != nil {
+				return err
+			}
+
+			// a profile signs in either with an AWS profile or with access keys, never both
+			if command.Flags().Changed("profile") && profile.Profile != "" {
+				profile.AccessKeyID = ""
+				profile.SecretAccessKey = ""
+				profile.SecretRef = ""
+
+				if oldRef != "" {
+					unused = unusedSecrets(file, oldRef)
+				}
+
+				return nil
+			}
+
+			if !keysChanged {
+				return nil
+			}
+
+			profile.Profile = ""
+
+			secrets, err := editSecretBackend(command, profile)
+
+			if err != nil {
+				return err
+			}
+
+			// a copy shares the secrets of its original, so it gets its own key instead of rewriting them
+			if file.SharesSecrets(i) {
+				profile.SecretRef = ""
+			}
+
+			if err = cmd.StoreSecrets(secrets, profile); err != nil {
+				return err
+			}
+
+			if oldRef != "" && oldRef != profile.SecretRef {
+				unused = unusedSecrets(file, oldRef)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if err = deleteSecrets(unused); err != nil {
+			return err
+		}
+
+		fmt.Printf("Updated profile %s\n", args[0])
+
+		return nil
+	},
+}
+
+// unlockEditSecrets asks for the passphrases of the backends access keys are read from, written
+// to or removed from, before the config file is locked.
+func unlockEditSecrets(command *cobra.Command, store *cmd.ProfileStore, name string) error {
+	keysChanged := command.Flags().Changed("access-key-id") || command.Flags().Changed("secret-access-key")
+
+	if !keysChanged && !command.Flags().Changed("profile") {
+		return nil
+	}
+
+	file, err := store.Load()
+
+	if err != nil {
+		return err
+	}
+
+	i, err := file.Profile(name)
+
+	if err != nil {
+		return err
+	}
+
+	profile := file.Profiles[i]
+
+	if err = cmd.UnlockSecretRef(profile.SecretRef); err != nil || !keysChanged {
+		return err
+	}
+
+	secrets, err := editSecretBackend(command, &profile)
+
+	if err != nil {
+		return err
+	}
+
+	return cmd.UnlockSecrets(secrets)
+}
+
+// editSecretBackend is the backend given by --secret-backend, otherwise the one the profile
+// already uses.
+func editSecretBackend(command *cobra.Command, profile *cmd.SavedConfig) (cmd.SecretBackend, error) {
+	name, _ := command.Flags().GetString("secret-backend")
+
+	if !command.Flags().Changed("secret-backend") && profile.SecretRef != "" {
+		return cmd.SecretRefBackend(profile.SecretRef)
+	}
+
+	return cmd.NewSecretBackend(name)
+}
+
+// applyEditFlags copies the flags that were passed onto profile.
+func applyEditFlags(command *cobra.Command, profile *cmd.SavedConfig) error {
+	flags := command.Flags()
+	fields := map[string]*string{
+		"bucket":            &profile.Bucket,
+		"region":            &profile.Region,
+		"directory":         &profile.Directory,
+		"profile":           &profile.Profile,
+		"role":              &profile.Role,
+		"distribution-id":   &profile.DistributionID,
+		"access-key-id":     &profile.AccessKeyID,
+		"secret-access-key": &profile.SecretAccessKey,
+		"html-keys":         &profile.HTMLKeys,
+	}
+
+	for name, field := range fields {
+		if flags.Changed(name) {
+			*field, _ = flags.GetString(name)
+		}
+	}
+
+	if err := cmd.ValidateKeyStrategy(profile.HTMLKeys); err != nil {
+		return err
+	}
+
+	if flags.Changed("html-exempt") {
+		profile.HTMLExempt, _ = flags.GetStringSlice("html-exempt")
+	}
+
+	if flags.Changed("preserve") {
+		profile.Preserve, _ = flags.GetStringArray("preserve")
+	}
+
+	if flags.Changed("header") {
+		values, _ := flags.GetStringArray("header")
+		headers := []cmd.HeaderRule{}
+
+		for _, value := range values {
+			rule, err := cmd.ParseHeaderRule(value)
+
+			if err != nil {
+				return err
+			}
+
+			headers = append(headers, rule)
+		}
+
+		profile.Headers = headers
+	}
+
+	return nil
+}
+
+func init() {
+	editCmd.Flags().StringP("directory", "d", "", "Path to the static site directory")
+	_ = editCmd.MarkFlagDirname("directory")
+	editCmd.Flags().StringP("bucket", "b", "", "S3 bucket name")
+	editCmd.Flags().StringP("region", "r", "", "S3 bucket region")
+	editCmd.Flags().String("access-key-id", "", "AWS Access Key ID")
+	editCmd.Flags().String("secret-access-key", "", "AWS Secret Access Key")
+	editCmd.Flags().String("secret-backend", cmd.DefaultSecretBackend, "Where new access keys are stored: secret-service, pass or file")
+	editCmd.Flags().StringP("profile", "p", "", "AWS Profile name")
+	editCmd.Flags().String("role", "", "Role to switch into")
+	editCmd.Flags().String("distribution-id", "", "CloudFront distribution to invalidate")
+	editCmd.Flags().String("html-keys", "", "How html files map to keys: strip-extension, directory-index, both or keep")
+	editCmd.Flags().StringSlice("html-exempt", nil, "html file names that keep their name at any depth")
+	editCmd.Flags().StringArray("preserve", nil, "Never remove remote keys matching this glob, replaces the saved list (repeatable)")
+	editCmd.Flags().StringArray("header", nil, "Header rule <glob>:<header>=<value>, replaces the saved rules (repeatable)")
+
+	configCmd.AddCommand(editCmd)
+}
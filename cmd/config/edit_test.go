@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+)
+
+func TestEdit(t *testing.T) {
+	store, dir := useConfigFile(t)
+	useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"))
+
+	err := runConfig("edit", "production", "--bucket", "new-site", "--header", "*.html:Cache-Control=no-cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := loadProfile(t, store, dir, "production")
+	headers := []cmd.HeaderRule{{Pattern: "*.html", CacheControl: "no-cache"}}
+
+	if profile.Bucket != "new-site" || profile.Region != "us-east-1" || !reflect.DeepEqual(profile.Headers, headers) {
+		t.Errorf("expected only the bucket and headers to change, got %+v", profile)
+	}
+}
+
+func TestEditSwitchesToAWSProfile(t *testing.T) {
+	store, dir := useConfigFile(t)
+	backend := useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"))
+
+	if err := runConfig("edit", "production", "--profile", "deploy"); err != nil {
+		t.Fatal(err)
+	}
+
+	profile := loadProfile(t, store, dir, "production")
+
+	if profile.Profile != "deploy" || profile.SecretRef != "" || profile.AccessKeyID != "" || profile.SecretAccessKey != "" {
+		t.Errorf("expected the access keys to be replaced by the AWS profile, got %+v", profile)
+	}
+
+	if len(backend.secrets) != 0 {
+		t.Errorf("expected the unused secrets to be deleted, got %v", backend.secrets)
+	}
+}
+
+func TestEditSwitchesToAccessKeys(t *testing.T) {
+	store, dir := useConfigFile(t)
+	backend := useMemoryBackend(t)
+	saveProfiles(t, store, dir, cmd.SavedConfig{Name: "production", Bucket: "site", Profile: "deploy"})
+
+	err := runConfig("edit", "production", "--access-key-id", "AKIANEW", "--secret-access-key", "new", "--secret-backend", "memory")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := loadProfile(t, store, dir, "production")
+
+	if profile.Profile != "" || !strings.HasPrefix(profile.SecretRef, "memory:") || profile.AccessKeyID != "" {
+		t.Errorf("expected the AWS profile to be replaced by stored access keys, got %+v", profile)
+	}
+
+	if len(backend.secrets) != 1 {
+		t.Errorf("expected the new keys to be stored, got %v", backend.secrets)
+	}
+
+	if err = runConfig("edit", "production", "--profile", "deploy", "--access-key-id", "AKIANEW"); err == nil {
+		t.Errorf("expected passing both an AWS profile and access keys to fail")
+	}
+}
+
+func TestEditKeepsSharedSecrets(t *testing.T) {
+	store, dir := useConfigFile(t)
+	backend := useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"))
+
+	if err := runConfig("copy", "production", "--to-dir", dir, "--name", "hotfix"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runConfig("edit", "hotfix", "--access-key-id", "AKIAHOTFIX"); err != nil {
+		t.Fatal(err)
+	}
+
+	original := *loadProfile(t, store, dir, "production")
+	copied := *loadProfile(t, store, dir, "hotfix")
+
+	if err := cmd.ResolveSecrets(&original); err != nil || original.AccessKeyID != "AKIAproduction" {
+		t.Errorf("expected the original to keep its keys, got %+v (%v)", original, err)
+	}
+
+	if err := cmd.ResolveSecrets(&copied); err != nil || copied.AccessKeyID != "AKIAHOTFIX" || copied.SecretAccessKey != "secret" {
+		t.Errorf("expected the copy to get its own keys, got %+v (%v)", copied, err)
+	}
+
+	if len(backend.secrets) != 2 {
+		t.Errorf("expected a secret per profile, got %v", backend.secrets)
+	}
+}
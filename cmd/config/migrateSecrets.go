@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var migrateSecretsCmd = &cobra.Command{
+	Use:   "migrate-secrets",
+	Short: "Move access keys saved in plaintext into a secret backend",
+	Long: `Moves the access keys of every saved profile, for all directories, out of config.json
+and into the secret backend, leaving only a reference behind. Profiles already using a
+backend are left alone.
+
+Example Usage:
+	go run . config migrate-secrets --secret-backend pass
+`,
+	Args: cobra.NoArgs,
+	RunE: func(command *cobra.Command, args []string) error {
+		name, _ := command.Flags().GetString("secret-backend")
+		secrets, err := cmd.NewSecretBackend(name)
+
+		if err != nil {
+			return err
+		}
+
+		store, err := cmd.NewProfileStore()
+
+		if err != nil {
+			return err
+		}
+
+		if err = unlockMigratedSecrets(store, secrets); err != nil {
+			return err
+		}
+
+		moved := 0
+
+		err = store.Update(func(file *cmd.SavedConfigFile) error {
+			for i := range file.Profiles {
+				profile := &file.Profiles[i]
+
+				if profile.SecretRef != "" || (profile.AccessKeyID == "" && profile.SecretAccessKey == "") {
+					continue
+				}
+
+				if err := cmd.StoreSecrets(secrets, profile); err != nil {
+					return err
+				}
+
+				moved++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Moved the secrets of %d profiles to %s\n", moved, secrets.Name())
+
+		return nil
+	},
+}
+
+// unlockMigratedSecrets asks for the passphrase of the backend, before the config file is
+// locked, when there are plaintext keys to move into it.
+func unlockMigratedSecrets(store *cmd.ProfileStore, secrets cmd.SecretBackend) error {
+	file, err := store.Load()
+
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range file.Profiles {
+		if profile.SecretRef == "" && (profile.AccessKeyID != "" || profile.SecretAccessKey != "") {
+			return cmd.UnlockSecrets(secrets)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	migrateSecretsCmd.Flags().String("secret-backend", cmd.DefaultSecretBackend, "Where access keys are stored: secret-service, pass or file (encrypted with a passphrase)")
+
+	configCmd.AddCommand(migrateSecretsCmd)
+}
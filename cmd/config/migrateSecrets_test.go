@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+)
+
+func TestMigrateSecrets(t *testing.T) {
+	store, dir := useConfigFile(t)
+	backend := useMemoryBackend(t)
+
+	// saved without a backend, the way profiles were before secret backends existed
+	for _, profile := range []cmd.SavedConfig{keyProfile("production"), {Name: "staging", Profile: "deploy"}} {
+		profile.UserDirectory = dir
+
+		if err := store.Add(profile, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runConfig("migrate-secrets", "--secret-backend", "memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	profile := loadProfile(t, store, dir, "production")
+
+	if profile.AccessKeyID != "" || profile.SecretAccessKey != "" || !strings.HasPrefix(profile.SecretRef, "memory:") {
+		t.Errorf("expected the keys to be moved into the backend, got %+v", profile)
+	}
+
+	if staging := loadProfile(t, store, dir, "staging"); staging.SecretRef != "" || len(backend.secrets) != 1 {
+		t.Errorf("expected profiles without keys to be left alone, got %+v", staging)
+	}
+
+	if err := cmd.ResolveSecrets(profile); err != nil || profile.AccessKeyID != "AKIAproduction" {
+		t.Errorf("expected the moved keys to resolve, got %+v (%v)", profile, err)
+	}
+}
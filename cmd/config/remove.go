@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var removeCmd = &cobra.Command{
+	Use:     "rm <name>",
+	Aliases: []string{"remove"},
+	Short:   "Delete a profile saved for this directory",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(command *cobra.Command, args []string) error {
+		store, err := cmd.NewProfileStore()
+
+		if err != nil {
+			return err
+		}
+
+		if err = unlockRemovedSecrets(store, args[0]); err != nil {
+			return err
+		}
+
+		var unused string
+
+		err = store.Update(func(file *cmd.SavedConfigFile) error {
+			i, err := file.Profile(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			ref := file.Profiles[i].SecretRef
+			file.Profiles = append(file.Profiles[:i], file.Profiles[i+1:]...)
+			unused = unusedSecrets(file, ref)
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// only once the profile is gone from the saved file, a failed save keeps its keys
+		if err = deleteSecrets(unused); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed profile %s\n", args[0])
+
+		return nil
+	},
+}
+
+// unlockRemovedSecrets asks for the passphrase of the backend holding the secrets remove
+// deletes, before the config file is locked.
+func unlockRemovedSecrets(store *cmd.ProfileStore, name string) error {
+	file, err := store.Load()
+
+	if err != nil {
+		return err
+	}
+
+	i, err := file.Profile(name)
+
+	if err != nil || file.SharesSecrets(i) {
+		return err
+	}
+
+	return cmd.UnlockSecretRef(file.Profiles[i].SecretRef)
+}
+
+// unusedSecrets returns ref if no profile uses it anymore, copies of a profile share its
+// secrets. It returns "" otherwise.
+func unusedSecrets(file *cmd.SavedConfigFile, ref string) string {
+	for _, profile := range file.Profiles {
+		if profile.SecretRef == ref {
+			return ""
+		}
+	}
+
+	return ref
+}
+
+// deleteSecrets removes the secrets ref points at, if there is one. It is called after the
+// config file was saved without the reference.
+func deleteSecrets(ref string) error {
+	if ref == "" {
+		return nil
+	}
+
+	return cmd.DeleteSecrets(ref)
+}
+
+func init() {
+	configCmd.AddCommand(removeCmd)
+}
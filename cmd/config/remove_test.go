@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	store, dir := useConfigFile(t)
+	backend := useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"), keyProfile("staging"))
+
+	key := strings.TrimPrefix(loadProfile(t, store, dir, "production").SecretRef, "memory:")
+
+	// the secrets may only go once the saved file no longer points at them
+	backend.onDelete = func(string) {
+		if loadProfile(t, store, dir, "production") != nil {
+			t.Errorf("expected the secrets to be deleted after the profile was saved without them")
+		}
+	}
+
+	if err := runConfig("rm", "production"); err != nil {
+		t.Fatal(err)
+	}
+
+	if loadProfile(t, store, dir, "production") != nil || loadProfile(t, store, dir, "staging") == nil {
+		t.Errorf("expected only production to be removed")
+	}
+
+	if _, exists := backend.secrets[key]; exists || len(backend.secrets) != 1 {
+		t.Errorf("expected only the secrets of production to be deleted, got %v", backend.secrets)
+	}
+
+	if err := runConfig("rm", "production"); err == nil {
+		t.Errorf("expected removing a missing profile to fail")
+	}
+}
+
+func TestRemoveSharedSecrets(t *testing.T) {
+	store, dir := useConfigFile(t)
+	backend := useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"))
+
+	if err := runConfig("copy", "production", "--to-dir", dir, "--name", "hotfix"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runConfig("rm", "production"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backend.secrets) != 1 {
+		t.Errorf("expected the copy to keep the shared secrets, got %v", backend.secrets)
+	}
+
+	if err := runConfig("rm", "hotfix"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backend.secrets) != 0 {
+		t.Errorf("expected the secrets to be deleted with the last profile using them, got %v", backend.secrets)
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <name> <new-name>",
+	Short: "Rename a profile saved for this directory",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(command *cobra.Command, args []string) error {
+		name, newName := args[0], args[1]
+		store, err := cmd.NewProfileStore()
+
+		if err != nil {
+			return err
+		}
+
+		err = store.Update(func(file *cmd.SavedConfigFile) error {
+			i, err := file.Profile(name)
+
+			if err != nil {
+				return err
+			}
+
+			if file.Find(newName, file.Profiles[i].UserDirectory) >= 0 {
+				return fmt.Errorf("profile %s already exists", newName)
+			}
+
+			file.Profiles[i].Name = newName
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Renamed profile %s to %s\n", name, newName)
+
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(renameCmd)
+}
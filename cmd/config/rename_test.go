@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestRename(t *testing.T) {
+	store, dir := useConfigFile(t)
+	useMemoryBackend(t)
+	saveProfiles(t, store, dir, keyProfile("production"), keyProfile("staging"))
+
+	if err := runConfig("rename", "production", "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	if loadProfile(t, store, dir, "production") != nil || loadProfile(t, store, dir, "prod") == nil {
+		t.Errorf("expected production to be renamed to prod")
+	}
+
+	if err := runConfig("rename", "prod", "staging"); err == nil {
+		t.Errorf("expected renaming onto an existing profile to fail")
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Print a single environment or saved profile",
+	Long: `Prints the environment of the project file, or the profile saved for this directory,
+that --config <name> would use. Access keys are starred out.
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(command *cobra.Command, args []string) error {
+		name := args[0]
+		project, err := cmd.LoadProjectFile(".")
+
+		if err != nil {
+			return err
+		}
+
+		if project != nil {
+			if env, ok := project.Environments[name]; ok {
+				printEnvironment(name, env)
+				return nil
+			}
+		}
+
+		store, err := cmd.NewProfileStore()
+
+		if err != nil {
+			return err
+		}
+
+		file, err := store.Load()
+
+		if err != nil {
+			return err
+		}
+
+		i, err := file.Profile(name)
+
+		if err != nil {
+			return err
+		}
+
+		printProfile(file.Profiles[i])
+
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(showCmd)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+const DefaultMaxDeletePercent = 50
+
+// ErrUnsafeDelete is returned when a run would remove more than the limits allow.
+var ErrUnsafeDelete = errors.New("refusing to remove objects, pass --force to run anyway")
+
+// DeleteLimits guard against a wrong prefix or directory wiping the bucket. A zero
+// MaxDeletes or MaxPercent disables that limit and Force skips every check.
+type DeleteLimits struct {
+	MaxDeletes int
+	MaxPercent float64
+	Force      bool
+}
+
+// Check returns ErrUnsafeDelete when plan removes objects while the local directory
+// has no files, or removes more objects than the limits allow. Percentages are of the
+// objects currently under the prefix.
+func (limits DeleteLimits) Check(plan *SyncPlan) error {
+	deletes := len(plan.Deletes)
+
+	if limits.Force || deletes == 0 {
+		return nil
+	}
+
+	local := len(plan.Adds) + len(plan.Updates) + len(plan.Unchanged)
+
+	if local == 0 {
+		return fmt.Errorf("%w: the local directory has no files and %d objects would be removed", ErrUnsafeDelete, deletes)
+	}
+
+	if limits.MaxDeletes > 0 && deletes > limits.MaxDeletes {
+		return fmt.Errorf("%w: %d objects would be removed, more than --max-deletes %d", ErrUnsafeDelete, deletes, limits.MaxDeletes)
+	}
+
+	remote := len(plan.Updates) + len(plan.Unchanged) + deletes + len(plan.Protected)
+	percent := float64(deletes) / float64(remote) * 100
+
+	if limits.MaxPercent > 0 && percent > limits.MaxPercent {
+		return fmt.Errorf("%w: %d of %d objects (%.0f%%) would be removed, more than --max-delete-percent %g", ErrUnsafeDelete, deletes, remote, percent, limits.MaxPercent)
+	}
+
+	return nil
+}
+
+// CheckDirectory refuses to empty the bucket when no directory was given.
+func (limits DeleteLimits) CheckDirectory(directory string) error {
+	if limits.Force || directory != "" {
+		return nil
+	}
+
+	return fmt.Errorf("%w: no directory given, every object under the prefix would be removed", ErrUnsafeDelete)
+}
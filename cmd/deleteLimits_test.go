@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeleteLimitsCheck(t *testing.T) {
+	objects := func(n int) []RemoteObject {
+		return make([]RemoteObject, n)
+	}
+	files := func(n int) []LocalFile {
+		return make([]LocalFile, n)
+	}
+
+	tests := []struct {
+		name   string
+		limits DeleteLimits
+		plan   SyncPlan
+		refuse bool
+	}{
+		{"no deletes", DeleteLimits{MaxDeletes: 1}, SyncPlan{Adds: files(3)}, false},
+		{"within limits", DeleteLimits{MaxDeletes: 2, MaxPercent: 50}, SyncPlan{Unchanged: files(2), Deletes: objects(2)}, false},
+		{"too many deletes", DeleteLimits{MaxDeletes: 2}, SyncPlan{Unchanged: files(10), Deletes: objects(3)}, true},
+		{"too large a share", DeleteLimits{MaxPercent: 50}, SyncPlan{Unchanged: files(1), Deletes: objects(2)}, true},
+		{"protected objects count towards the total", DeleteLimits{MaxPercent: 50}, SyncPlan{Unchanged: files(1), Deletes: objects(2), Protected: objects(1)}, false},
+		{"no local files", DeleteLimits{}, SyncPlan{Deletes: objects(1)}, true},
+		{"forced", DeleteLimits{MaxDeletes: 1, Force: true}, SyncPlan{Deletes: objects(5)}, false},
+	}
+
+	for _, test := range tests {
+		err := test.limits.Check(&test.plan)
+
+		if test.refuse && !errors.Is(err, ErrUnsafeDelete) {
+			t.Errorf("%s: expected ErrUnsafeDelete, got %v", test.name, err)
+		}
+
+		if !test.refuse && err != nil {
+			t.Errorf("%s: expected no error, got %s", test.name, err)
+		}
+	}
+}
+
+func TestDeleteLimitsCheckDirectory(t *testing.T) {
+	if err := (DeleteLimits{}).CheckDirectory(""); !errors.Is(err, ErrUnsafeDelete) {
+		t.Errorf("expected ErrUnsafeDelete without a directory, got %v", err)
+	}
+
+	if err := (DeleteLimits{Force: true}).CheckDirectory(""); err != nil {
+		t.Errorf("expected --force to allow emptying the bucket, got %s", err)
+	}
+}
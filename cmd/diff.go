@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+func ValidateOutput(output string) error {
+	switch output {
+	case OutputText, OutputJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output %q, use %s or %s", output, OutputText, OutputJSON)
+	}
+}
+
+// MetadataDrift is a header of a remote object that differs from what a sync would upload.
+type MetadataDrift struct {
+	Key    string `json:"key"`
+	Header string `json:"header"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// DiffReport compares the keys a directory maps to with the objects under the prefix.
+// Kept objects only exist remotely but are protected, so they are not a difference.
+type DiffReport struct {
+	Bucket     string          `json:"bucket"`
+	Prefix     string          `json:"prefix"`
+	New        []string        `json:"new"`
+	Changed    []string        `json:"changed"`
+	Unchanged  []string        `json:"unchanged"`
+	RemoteOnly []string        `json:"remoteOnly"`
+	Kept       []string        `json:"kept"`
+	Drift      []MetadataDrift `json:"drift"`
+	Different  bool            `json:"different"`
+}
+
+func DiffDirectory(directory, bucket, prefix string, options UploadOptions, client S3API, ctx context.Context) (*DiffReport, error) {
+	plan, err := PlanSync(directory, bucket, prefix, options, client, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{
+		Bucket:     bucket,
+		Prefix:     prefix,
+		New:        fileKeys(plan.Adds),
+		Changed:    fileKeys(plan.Updates),
+		Unchanged:  fileKeys(plan.Unchanged),
+		RemoteOnly: plan.DeleteKeys(),
+		Kept:       []string{},
+	}
+
+	for _, obj := range plan.Protected {
+		report.Kept = append(report.Kept, obj.Key)
+	}
+
+	report.Drift, err = metadataDrift(append(append([]LocalFile{}, plan.Updates...), plan.Unchanged...), bucket, options, client, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report.Different = len(report.New)+len(report.Changed)+len(report.RemoteOnly)+len(report.Drift) > 0
+
+	return report, nil
+}
+
+func fileKeys(files []LocalFile) []string {
+	keys := make([]string, 0, len(files))
+
+	for _, file := range files {
+		keys = append(keys, file.Key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// metadataDrift compares the Content-Type and Cache-Control of the remote objects with
+// the headers files would be uploaded with.
+func metadataDrift(files []LocalFile, bucket string, options UploadOptions, client S3API, ctx context.Context) ([]MetadataDrift, error) {
+	concurrency := options.Concurrency
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	jobs := make(chan LocalFile)
+	drift := []MetadataDrift{}
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for file := range jobs {
+				found, err := fileDrift(file, bucket, options, client, ctx)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", file.Key, err)
+				}
+				drift = append(drift, found...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		jobs <- file
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].Key != drift[j].Key {
+			return drift[i].Key < drift[j].Key
+		}
+
+		return drift[i].Header < drift[j].Header
+	})
+
+	return drift, nil
+}
+
+func fileDrift(file LocalFile, bucket string, options UploadOptions, client S3API, ctx context.Context) ([]MetadataDrift, error) {
+	expected, err := putObjectInput(file, bucket, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(file.Key),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []MetadataDrift
+
+	for _, header := range []struct{ name, local, remote string }{
+		{"Content-Type", aws.ToString(expected.ContentType), aws.ToString(head.ContentType)},
+		{"Cache-Control", aws.ToString(expected.CacheControl), aws.ToString(head.CacheControl)},
+	} {
+		if header.local != header.remote {
+			drift = append(drift, MetadataDrift{Key: file.Key, Header: header.name, Local: header.local, Remote: header.remote})
+		}
+	}
+
+	return drift, nil
+}
+
+func (report *DiffReport) Print() {
+	fmt.Printf("Diff against s3://%s/%s\n", report.Bucket, report.Prefix)
+
+	for _, group := range []struct {
+		marker string
+		keys   []string
+	}{
+		{"+ new      ", report.New},
+		{"~ changed  ", report.Changed},
+		{"- remote   ", report.RemoteOnly},
+		{"= kept     ", report.Kept},
+		{"  unchanged", report.Unchanged},
+	} {
+		for _, key := range group.keys {
+			fmt.Printf("  %s %s\n", group.marker, key)
+		}
+	}
+
+	for _, drift := range report.Drift {
+		fmt.Printf("  ! drift     %s %s is %q, would be %q\n", drift.Key, drift.Header, drift.Remote, drift.Local)
+	}
+
+	fmt.Printf(
+		"%d new, %d changed, %d unchanged, %d remote only, %d kept, %d headers drifted\n",
+		len(report.New), len(report.Changed), len(report.Unchanged), len(report.RemoteOnly), len(report.Kept), len(report.Drift),
+	)
+}
+
+func (report *DiffReport) PrintJSON() error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+// Diff connects with the credentials of userInput and compares its directory with the bucket.
+func Diff(userInput *Config, ctx context.Context) (*DiffReport, error) {
+	awsConfig, err := connect(userInput, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := DiffDirectory(userInput.Directory, userInput.Bucket, userInput.Prefix, userInput.UploadOptions(), newS3Client(awsConfig), ctx)
+
+	return report, checkAccess(err)
+}
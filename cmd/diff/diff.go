@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+const (
+	exitDifferent = 1
+	exitError     = 2
+)
+
+// diffError keeps the status of a categorized error and exits with a status of its own
+// otherwise, since 1 already means the directory and bucket differ.
+func diffError(err error) error {
+	if cmd.ExitCode(err) != cmd.ExitFailure {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+
+	return &cmd.ExitError{Code: exitError, Err: err}
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare a local directory with the files in a bucket",
+	Long: `Shows which files are new, changed, unchanged or only exist in the bucket, after html
+files are mapped to their keys, and which objects have a Content-Type or Cache-Control header
+that differs from what a sync would upload.
+
+Like diff(1) it exits with 0 when there are no differences, 1 when there are and 2 when the
+comparison failed, or with the exit code of the failure's category (see the root command).
+Remote keys protected by --exclude or --preserve are not a difference.
+
+Example Usage:
+	go run . diff -d ./dist -b s3-bucket-name --output json
+`,
+	RunE: func(command *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		output, _ := command.Flags().GetString("output")
+
+		if err := cmd.ValidateOutput(output); err != nil {
+			return diffError(err)
+		}
+
+		config, err := cmd.NewConfig(command, args)
+
+		if err != nil {
+			return diffError(err)
+		}
+
+		if config.Directory == "" {
+			return diffError(errors.New("directory is required"))
+		}
+
+		report, err := cmd.Diff(config, ctx)
+
+		if err != nil {
+			return diffError(err)
+		}
+
+		if output == cmd.OutputJSON {
+			err = report.PrintJSON()
+		} else {
+			report.Print()
+		}
+
+		if err != nil {
+			return diffError(err)
+		}
+
+		if report.Different {
+			return &cmd.ExitError{Code: exitDifferent}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	cmd.AddBucketFlags(diffCmd)
+	diffCmd.Flags().StringP("directory", "d", "", "Path to the static site directory")
+	_ = diffCmd.MarkFlagDirname("directory")
+	diffCmd.Flags().StringArray("header", nil, "Header rule <glob>:<header>=<value>, e.g. '*.html:Cache-Control=no-cache' (repeatable)")
+	diffCmd.Flags().StringArray("exclude", nil, "Skip files matching this gitignore style glob, also keeps matching remote keys (repeatable)")
+	diffCmd.Flags().StringArray("include", nil, "Compare files matching this glob even if they are excluded (repeatable)")
+	diffCmd.Flags().StringArray("preserve", nil, "Remote keys matching this glob, relative to the prefix, are kept (repeatable)")
+	diffCmd.Flags().String("html-keys", cmd.HTMLStripExtension, "How html files map to keys: strip-extension, directory-index, both or keep")
+	diffCmd.Flags().StringSlice("html-exempt", cmd.DefaultHTMLExempt, "html file names that keep their name at any depth")
+	diffCmd.Flags().String("compress", "", "Compare against files compressed with gzip or br")
+	diffCmd.Flags().StringSlice("compress-types", cmd.DefaultCompressTypes, "MIME types or extensions (like .wasm) to compress")
+	diffCmd.Flags().Int64("multipart-threshold", cmd.DefaultMultipartThreshold/cmd.MiB, "Files of at least this many MiB are uploaded in parts")
+	diffCmd.Flags().Int64("part-size", cmd.DefaultPartSize/cmd.MiB, "Size of each part in MiB for multipart uploads")
+	diffCmd.Flags().Int("concurrency", cmd.DefaultConcurrency, "Number of objects to check at the same time")
+	diffCmd.Flags().String("output", cmd.OutputText, "Output format, text or json")
+
+	cmd.RootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestDiffDirectory(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html":     "<h1>home</h1>",
+		"about.html":     "<h1>about</h1>",
+		"css/styles.css": "body {}",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--header", "*.css:Cache-Control=max-age=60")
+
+	bucket.Put("removed", []byte("gone"), "text/html; charset=utf-8")
+	bucket.Put("robots.txt", []byte("kept"), "text/plain")
+	bucket.SetCacheControl("css/styles.css", "no-cache")
+
+	if err := os.WriteFile(filepath.Join(dir, "about.html"), []byte("<h1>new about</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "blog.html"), []byte("<h1>blog</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rule, _ := ParseHeaderRule("*.css:Cache-Control=max-age=60")
+	options := UploadOptions{Headers: []HeaderRule{rule}, Preserve: []string{"robots.txt"}}
+	report, err := DiffDirectory(dir, "site", "", options, bucket, context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &DiffReport{
+		Bucket:     "site",
+		New:        []string{"blog"},
+		Changed:    []string{"about"},
+		Unchanged:  []string{"css/styles.css", "index.html"},
+		RemoteOnly: []string{"removed"},
+		Kept:       []string{"robots.txt"},
+		Drift:      []MetadataDrift{{Key: "css/styles.css", Header: "Cache-Control", Local: "max-age=60", Remote: "no-cache"}},
+		Different:  true,
+	}
+
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+}
+
+func TestDiffDirectoryInSync(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "<h1>home</h1>"})
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+
+	report, err := DiffDirectory(dir, "site", "", UploadOptions{}, bucket, context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Different {
+		t.Errorf("expected no differences, got %+v", report)
+	}
+}
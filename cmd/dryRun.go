@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+)
+
+// DeployPlan is everything a run would change, computed using only read calls.
+type DeployPlan struct {
+	Bucket       string
+	Prefix       string
+	Sync         *SyncPlan
+	Invalidation *InvalidationPlan
+	Release      *ReleaseOptions
+}
+
+type InvalidationPlan struct {
+	DistributionID string   `json:"distributionId"`
+	Paths          []string `json:"paths"`
+}
+
+// PlanDeploy lists the bucket (and CloudFront distributions when invalidating) without
+// writing anything. cfClient is only used when userInput.CfInvalidate is set.
+func PlanDeploy(userInput *Config, client S3API, cfClient CloudFrontAPI, ctx context.Context) (*DeployPlan, error) {
+	prefix := userInput.Prefix
+
+	if userInput.Release.Enabled {
+		prefix = ReleasePrefix(prefix, userInput.Release.ID)
+	}
+
+	syncPlan, err := PlanSync(userInput.Directory, userInput.Bucket, prefix, userInput.UploadOptions(), client, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = syncPlan.updateDrifted(userInput.Bucket, userInput.UploadOptions(), client, ctx); err != nil {
+		return nil, err
+	}
+
+	plan := &DeployPlan{
+		Bucket: userInput.Bucket,
+		Prefix: prefix,
+		Sync:   syncPlan,
+	}
+
+	// switching to a release invalidates everything, so there is no path list to plan
+	if userInput.Release.Enabled {
+		plan.Release = &userInput.Release
+		return plan, nil
+	}
+
+	changedKeys := plan.Sync.ChangedKeys()
+
+	if !userInput.CfInvalidate || len(changedKeys) == 0 {
+		return plan, nil
+	}
+
+	distributionID, originPath, err := ResolveDistributionID(userInput, cfClient, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := DistributionPaths(changedKeys, userInput.Prefix, originPath, userInput.InvalidationThreshold)
+
+	// like a run, nothing is invalidated when the distribution serves none of the changes
+	if len(paths) > 0 {
+		plan.Invalidation = &InvalidationPlan{DistributionID: distributionID, Paths: paths}
+	}
+
+	return plan, nil
+}
+
+// Event describes the plan for rendering, the text renderer prints one line per change.
+func (plan *DeployPlan) Event() *DryRunEvent {
+	event := &DryRunEvent{
+		Bucket:       plan.Bucket,
+		Prefix:       plan.Prefix,
+		Add:          plannedFiles(plan.Sync.Adds),
+		Update:       plannedFiles(plan.Sync.Updates),
+		Delete:       plan.Sync.DeleteKeys(),
+		Keep:         []string{},
+		Unchanged:    len(plan.Sync.Unchanged),
+		Invalidation: plan.Invalidation,
+	}
+
+	for _, obj := range plan.Sync.Protected {
+		event.Keep = append(event.Keep, obj.Key)
+	}
+
+	if plan.Release != nil {
+		event.Release = plan.Release.ID
+		event.ReleaseSwitch = plan.Release.Switch
+	}
+
+	return event
+}
+
+func plannedFiles(files []LocalFile) []PlannedFile {
+	planned := make([]PlannedFile, 0, len(files))
+
+	for _, file := range files {
+		planned = append(planned, PlannedFile{Key: file.Key, MimeType: file.MimeType})
+	}
+
+	return planned
+}
@@ -3,46 +3,113 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-func EmptyBucket(bucketName, prefix string, client *s3.Client, ctx context.Context) error {
-	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucketName),
-		Prefix: &prefix,
-	})
+type DeleteFailure struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// DeleteError is returned when one or more objects could not be removed.
+type DeleteError struct {
+	Failures []DeleteFailure
+}
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+func (err *DeleteError) Error() string {
+	lines := make([]string, 0, len(err.Failures))
 
-		if err != nil {
-			return err
+	for _, failure := range err.Failures {
+		lines = append(lines, fmt.Sprintf("  %s: %s %s", failure.Key, failure.Code, failure.Message))
+	}
+
+	return fmt.Sprintf("failed to remove %d objects:\n%s", len(err.Failures), strings.Join(lines, "\n"))
+}
+
+// EmptyBucket removes every object under prefix, except for the keys protect matches.
+func EmptyBucket(bucketName, prefix string, protect ProtectRules, client S3API, ctx context.Context) error {
+	objects, err := ListRemoteObjects(bucketName, prefix, client, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects))
+
+	for key := range objects {
+		if protect.Protects(key, prefix) {
+			emit(&KeepEvent{Key: key})
+			continue
 		}
 
-		var objects []types.ObjectIdentifier
+		keys = append(keys, key)
+	}
 
-		for _, obj := range page.Contents {
-			fmt.Printf("> removing object %s\n", *obj.Key)
-			objects = append(objects, types.ObjectIdentifier{Key: obj.Key})
+	sort.Strings(keys)
+
+	return DeleteObjects(bucketName, keys, client, ctx)
+}
+
+// DeleteObjects removes keys in batches, attempting every batch and returning a
+// *DeleteError listing each key that could not be removed.
+func DeleteObjects(bucket string, keys []string, client S3API, ctx context.Context) error {
+	var failures []DeleteFailure
+
+	// DeleteObjects accepts at most 1000 keys per request
+	for start := 0; start < len(keys); start += 1000 {
+		end := start + 1000
+
+		if end > len(keys) {
+			end = len(keys)
 		}
 
-		if len(objects) == 0 {
-			continue
+		var objects []types.ObjectIdentifier
+
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
 		}
 
-		_, err = client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(bucketName),
+		output, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
 			Delete: &types.Delete{
 				Objects: objects,
 			},
 		})
 
+		batchFailures := map[string]DeleteFailure{}
+
 		if err != nil {
-			return nil
+			for _, key := range keys[start:end] {
+				batchFailures[key] = DeleteFailure{Key: key, Code: "RequestFailed", Message: err.Error()}
+			}
+		} else {
+			for _, deleteErr := range output.Errors {
+				key := aws.ToString(deleteErr.Key)
+				batchFailures[key] = DeleteFailure{Key: key, Code: aws.ToString(deleteErr.Code), Message: aws.ToString(deleteErr.Message)}
+			}
 		}
+
+		for _, key := range keys[start:end] {
+			failure, failed := batchFailures[key]
+
+			if !failed {
+				emit(&RemoveEvent{Key: key})
+				continue
+			}
+
+			failures = append(failures, failure)
+			emit(&RemoveEvent{Key: key, Error: failure.Code + " " + failure.Message})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &DeleteError{Failures: failures}
 	}
 
 	return nil
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestEmptyBucketReportsFailedKeys(t *testing.T) {
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("a", []byte("a"), "")
+	bucket.Put("b", []byte("b"), "")
+	bucket.Put("c", []byte("c"), "")
+	bucket.DenyDeletes("b")
+
+	err := EmptyBucket("site", "", ProtectRules{}, bucket, context.Background())
+
+	var deleteErr *DeleteError
+
+	if !errors.As(err, &deleteErr) {
+		t.Fatalf("expected a DeleteError, got %v", err)
+	}
+
+	expected := []DeleteFailure{{Key: "b", Code: "AccessDenied", Message: "Access Denied"}}
+
+	if !reflect.DeepEqual(deleteErr.Failures, expected) {
+		t.Errorf("expected %v, got %v", expected, deleteErr.Failures)
+	}
+
+	if keys := bucket.Keys(); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Errorf("expected only b to remain, got %v", keys)
+	}
+}
+
+func TestEmptyBucketRequestFailure(t *testing.T) {
+	err := DeleteObjects("missing", []string{"a", "b"}, fakeaws.NewBucket("site"), context.Background())
+
+	var deleteErr *DeleteError
+
+	if !errors.As(err, &deleteErr) || len(deleteErr.Failures) != 2 {
+		t.Fatalf("expected both keys to fail, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Every step of a run is reported as an event, which a renderer turns into a line of
+// text or, with --output json, a JSON object per line.
+const (
+	EventMessage      = "message"
+	EventPlan         = "plan"
+	EventUpload       = "upload"
+	EventRemove       = "remove"
+	EventKeep         = "keep"
+	EventInvalidation = "invalidation"
+	EventDryRun       = "dryRun"
+	EventError        = "error"
+	EventSummary      = "summary"
+)
+
+const (
+	InvalidationCreated   = "created"
+	InvalidationCompleted = "completed"
+)
+
+type EventHeader struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+}
+
+func (header *EventHeader) stamp(eventType string, now time.Time) {
+	header.Type = eventType
+	header.Time = now
+}
+
+type Event interface {
+	eventType() string
+	stamp(eventType string, now time.Time)
+}
+
+type MessageEvent struct {
+	EventHeader
+	Message string `json:"message"`
+}
+
+// PlanEvent is sent once the local files were compared with the bucket.
+type PlanEvent struct {
+	EventHeader
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	New       int    `json:"new"`
+	Changed   int    `json:"changed"`
+	Unchanged int    `json:"unchanged"`
+	Remove    int    `json:"remove"`
+	Kept      int    `json:"kept"`
+}
+
+// UploadEvent is sent once an upload finished, Error is set if it failed.
+type UploadEvent struct {
+	EventHeader
+	Key        string `json:"key"`
+	MimeType   string `json:"mimeType"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RemoveEvent is sent for every key a delete request was made for, Error is set if
+// the key could not be removed.
+type RemoveEvent struct {
+	EventHeader
+	Key   string `json:"key"`
+	Error string `json:"error,omitempty"`
+}
+
+// KeepEvent is sent for protected keys that are left in place.
+type KeepEvent struct {
+	EventHeader
+	Key string `json:"key"`
+}
+
+type InvalidationEvent struct {
+	EventHeader
+	DistributionID string   `json:"distributionId"`
+	InvalidationID string   `json:"invalidationId"`
+	Paths          []string `json:"paths,omitempty"`
+	Status         string   `json:"status"`
+}
+
+type PlannedFile struct {
+	Key      string `json:"key"`
+	MimeType string `json:"mimeType"`
+}
+
+// DryRunEvent is the deploy plan printed by --dry-run.
+type DryRunEvent struct {
+	EventHeader
+	Bucket        string            `json:"bucket"`
+	Prefix        string            `json:"prefix"`
+	Add           []PlannedFile     `json:"add"`
+	Update        []PlannedFile     `json:"update"`
+	Delete        []string          `json:"delete"`
+	Keep          []string          `json:"keep"`
+	Unchanged     int               `json:"unchanged"`
+	Release       string            `json:"release,omitempty"`
+	ReleaseSwitch string            `json:"releaseSwitch,omitempty"`
+	Invalidation  *InvalidationPlan `json:"invalidation,omitempty"`
+	Warning       string            `json:"warning,omitempty"`
+}
+
+// ErrorEvent ends a failed run, Message says which step failed when that is not
+// clear from the error itself.
+type ErrorEvent struct {
+	EventHeader
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error"`
+}
+
+// SummaryEvent is always the last event of a run.
+type SummaryEvent struct {
+	EventHeader
+	Success       bool     `json:"success"`
+	Uploaded      int      `json:"uploaded"`
+	UploadFailed  int      `json:"uploadFailed"`
+	Bytes         int64    `json:"bytes"`
+	Unchanged     int      `json:"unchanged"`
+	Removed       int      `json:"removed"`
+	RemoveFailed  int      `json:"removeFailed"`
+	Kept          int      `json:"kept"`
+	Invalidations []string `json:"invalidations"`
+	DurationMs    int64    `json:"durationMs"`
+	Error         string   `json:"error,omitempty"`
+}
+
+func (*MessageEvent) eventType() string      { return EventMessage }
+func (*PlanEvent) eventType() string         { return EventPlan }
+func (*UploadEvent) eventType() string       { return EventUpload }
+func (*RemoveEvent) eventType() string       { return EventRemove }
+func (*KeepEvent) eventType() string         { return EventKeep }
+func (*InvalidationEvent) eventType() string { return EventInvalidation }
+func (*DryRunEvent) eventType() string       { return EventDryRun }
+func (*ErrorEvent) eventType() string        { return EventError }
+func (*SummaryEvent) eventType() string      { return EventSummary }
+
+type Renderer interface {
+	Render(event Event)
+}
+
+// TextRenderer prints events as the progress lines of a terminal run. Errors go to Err.
+type TextRenderer struct {
+	Out io.Writer
+	Err io.Writer
+}
+
+func (renderer TextRenderer) Render(event Event) {
+	out := renderer.Out
+
+	switch event := event.(type) {
+	case *MessageEvent:
+		fmt.Fprintf(out, "> %s\n", event.Message)
+	case *PlanEvent:
+		fmt.Fprintf(out, "> %d new, %d changed, %d unchanged, %d to remove\n", event.New, event.Changed, event.Unchanged, event.Remove)
+	case *UploadEvent:
+		if event.Error != "" {
+			fmt.Fprintf(out, "> failed to upload %s: %s\n", event.Key, event.Error)
+		} else {
+			fmt.Fprintf(out, "> uploaded %s - %s (%d bytes in %dms)\n", event.Key, event.MimeType, event.Bytes, event.DurationMs)
+		}
+	case *RemoveEvent:
+		if event.Error != "" {
+			fmt.Fprintf(out, "> failed to remove %s: %s\n", event.Key, event.Error)
+		} else {
+			fmt.Fprintf(out, "> removed object %s\n", event.Key)
+		}
+	case *KeepEvent:
+		fmt.Fprintf(out, "> keeping object %s\n", event.Key)
+	case *InvalidationEvent:
+		if event.Status == InvalidationCompleted {
+			fmt.Fprintf(out, "> invalidation %s completed\n", event.InvalidationID)
+		} else {
+			fmt.Fprintf(out, "> created invalidation %s for %d paths\n", event.InvalidationID, len(event.Paths))
+		}
+	case *DryRunEvent:
+		renderer.renderDryRun(event)
+	case *ErrorEvent:
+		if event.Message != "" {
+			fmt.Fprintln(out, event.Message)
+		}
+
+		log.New(renderer.Err, "", log.LstdFlags).Println(event.Error)
+	case *SummaryEvent:
+		if event.Success {
+			fmt.Fprintf(
+				out, "> done in %s: %d uploaded, %d unchanged, %d removed, %d kept\n",
+				time.Duration(event.DurationMs)*time.Millisecond, event.Uploaded, event.Unchanged, event.Removed, event.Kept,
+			)
+		}
+	}
+}
+
+func (renderer TextRenderer) renderDryRun(plan *DryRunEvent) {
+	out := renderer.Out
+
+	fmt.Fprintf(out, "Plan for s3://%s/%s\n", plan.Bucket, plan.Prefix)
+
+	for _, file := range plan.Add {
+		fmt.Fprintf(out, "  + add     %s - %s\n", file.Key, file.MimeType)
+	}
+
+	for _, file := range plan.Update {
+		fmt.Fprintf(out, "  ~ update  %s - %s\n", file.Key, file.MimeType)
+	}
+
+	for _, key := range plan.Delete {
+		fmt.Fprintf(out, "  - delete  %s\n", key)
+	}
+
+	for _, key := range plan.Keep {
+		fmt.Fprintf(out, "  = keep    %s\n", key)
+	}
+
+	if plan.Release != "" {
+		fmt.Fprintf(out, "  ! switch to release %s using the %s switch\n", plan.Release, plan.ReleaseSwitch)
+	}
+
+	if plan.Invalidation != nil {
+		for _, path := range plan.Invalidation.Paths {
+			fmt.Fprintf(out, "  ! invalidate %s on distribution %s\n", path, plan.Invalidation.DistributionID)
+		}
+	}
+
+	fmt.Fprintf(
+		out, "%d to add, %d to update, %d to delete, %d unchanged, %d kept\n",
+		len(plan.Add), len(plan.Update), len(plan.Delete), plan.Unchanged, len(plan.Keep),
+	)
+
+	if plan.Invalidation == nil && plan.Release == "" {
+		fmt.Fprintln(out, "No CloudFront invalidation")
+	}
+
+	if plan.Warning != "" {
+		fmt.Fprintf(out, "Warning: %s\n", plan.Warning)
+	}
+}
+
+// JSONRenderer writes every event as a single line of JSON.
+type JSONRenderer struct {
+	Out io.Writer
+}
+
+func (renderer JSONRenderer) Render(event Event) {
+	// an event always encodes, and there is nowhere left to report a failed write
+	_ = json.NewEncoder(renderer.Out).Encode(event)
+}
+
+func NewRenderer(output string) Renderer {
+	if output == OutputJSON {
+		return JSONRenderer{Out: stdout}
+	}
+
+	return TextRenderer{Out: stdout, Err: stderr}
+}
+
+// Reporter stamps events, hands them to its renderer one at a time and keeps the
+// totals for the summary. It is safe for concurrent use.
+type Reporter struct {
+	mu       sync.Mutex
+	renderer Renderer
+	started  time.Time
+	summary  SummaryEvent
+}
+
+func NewReporter(renderer Renderer) *Reporter {
+	return &Reporter{renderer: renderer, started: time.Now(), summary: SummaryEvent{Invalidations: []string{}}}
+}
+
+func (reporter *Reporter) Emit(event Event) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	event.stamp(event.eventType(), time.Now().UTC())
+	reporter.count(event)
+	reporter.renderer.Render(event)
+}
+
+func (reporter *Reporter) count(event Event) {
+	summary := &reporter.summary
+
+	switch event := event.(type) {
+	case *PlanEvent:
+		summary.Unchanged += event.Unchanged
+		summary.Kept += event.Kept
+	case *UploadEvent:
+		if event.Error != "" {
+			summary.UploadFailed++
+		} else {
+			summary.Uploaded++
+			summary.Bytes += event.Bytes
+		}
+	case *RemoveEvent:
+		if event.Error != "" {
+			summary.RemoveFailed++
+		} else {
+			summary.Removed++
+		}
+	case *KeepEvent:
+		summary.Kept++
+	case *InvalidationEvent:
+		if event.Status == InvalidationCreated {
+			summary.Invalidations = append(summary.Invalidations, event.InvalidationID)
+		}
+	}
+}
+
+// Finish sends the summary, reporting err first if the run failed.
+func (reporter *Reporter) Finish(message string, err error) {
+	if err != nil {
+		reporter.Emit(&ErrorEvent{Message: message, Error: err.Error()})
+	}
+
+	reporter.mu.Lock()
+	summary := reporter.summary
+	reporter.mu.Unlock()
+
+	summary.Success = err == nil
+	summary.DurationMs = time.Since(reporter.started).Milliseconds()
+
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	reporter.Emit(&summary)
+}
+
+// These are swapped out in tests to capture the output of a run.
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// reporter receives the events of the current run, commands replace it to pick a renderer.
+var reporter = NewReporter(TextRenderer{Out: os.Stdout, Err: os.Stderr})
+
+func emit(event Event) {
+	reporter.Emit(event)
+}
+
+func message(format string, args ...any) {
+	emit(&MessageEvent{Message: fmt.Sprintf(format, args...)})
+}
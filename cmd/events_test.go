@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+// captureOutput sends everything the run renders to a buffer.
+func captureOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	stdout, stderr = buffer, buffer
+	reporter = NewReporter(TextRenderer{Out: buffer, Err: buffer})
+
+	t.Cleanup(func() {
+		stdout, stderr = os.Stdout, os.Stderr
+		reporter = NewReporter(TextRenderer{Out: os.Stdout, Err: os.Stderr})
+	})
+
+	return buffer
+}
+
+func TestRootJSONOutput(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home", "app.js": "app"})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("index.html", []byte("home"), "text/html; charset=utf-8")
+	bucket.Put("old.js", []byte("old"), "text/javascript; charset=utf-8")
+	bucket.Put("old.css", []byte("old"), "text/css; charset=utf-8")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "SITE", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com"}}},
+	)
+	output := captureOutput(t)
+
+	runRoot(t, bucket, distributions, "--directory", dir, "--cf-invalidate", "--wait-invalidation", "--force", "--output", "json")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	var types []string
+	var summary SummaryEvent
+
+	for _, line := range lines {
+		var header EventHeader
+
+		if err := json.Unmarshal([]byte(line), &header); err != nil {
+			t.Fatalf("invalid event %q: %s", line, err)
+		}
+
+		types = append(types, header.Type)
+
+		switch header.Type {
+		case EventUpload:
+			var upload UploadEvent
+			_ = json.Unmarshal([]byte(line), &upload)
+
+			if upload.Key != "app.js" || upload.MimeType != "text/javascript; charset=utf-8" || upload.Bytes != 3 {
+				t.Errorf("unexpected upload event %s", line)
+			}
+		case EventInvalidation:
+			var invalidation InvalidationEvent
+			_ = json.Unmarshal([]byte(line), &invalidation)
+
+			if invalidation.DistributionID != "SITE" || invalidation.InvalidationID == "" {
+				t.Errorf("unexpected invalidation event %s", line)
+			}
+		case EventMessage:
+			var msg MessageEvent
+			_ = json.Unmarshal([]byte(line), &msg)
+
+			// the "> " prefix belongs to the text renderer
+			if strings.HasPrefix(msg.Message, ">") {
+				t.Errorf("expected a message without terminal formatting, got %s", line)
+			}
+		case EventSummary:
+			_ = json.Unmarshal([]byte(line), &summary)
+		}
+	}
+
+	expected := []string{
+		EventPlan, EventUpload, EventMessage, EventRemove, EventRemove,
+		EventMessage, EventInvalidation, EventMessage, EventInvalidation, EventMessage, EventSummary,
+	}
+
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected events %v, got %v", expected, types)
+	}
+
+	if !summary.Success || summary.Uploaded != 1 || summary.Bytes != 3 || summary.Removed != 2 || summary.Unchanged != 1 || len(summary.Invalidations) != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestReporterFinish(t *testing.T) {
+	output := &bytes.Buffer{}
+	reporter := NewReporter(JSONRenderer{Out: output})
+
+	reporter.Emit(&UploadEvent{Key: "a", Bytes: 4})
+	reporter.Emit(&UploadEvent{Key: "b", Error: "denied"})
+	reporter.Emit(&RemoveEvent{Key: "c", Error: "AccessDenied"})
+	reporter.Emit(&KeepEvent{Key: "d"})
+	reporter.Finish("Failed to clear bucket", errors.New("failed"))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 events, got %d", len(lines))
+	}
+
+	var failure ErrorEvent
+	var summary SummaryEvent
+
+	if err := json.Unmarshal([]byte(lines[4]), &failure); err != nil || failure.Type != EventError || failure.Message != "Failed to clear bucket" {
+		t.Errorf("unexpected error event %s", lines[4])
+	}
+
+	if err := json.Unmarshal([]byte(lines[5]), &summary); err != nil || summary.Type != EventSummary {
+		t.Fatalf("unexpected summary %s", lines[5])
+	}
+
+	expected := SummaryEvent{
+		EventHeader:   summary.EventHeader,
+		Uploaded:      1,
+		UploadFailed:  1,
+		Bytes:         4,
+		RemoveFailed:  1,
+		Kept:          1,
+		Invalidations: []string{},
+		DurationMs:    summary.DurationMs,
+		Error:         "failed",
+	}
+
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected summary %+v, got %+v", expected, summary)
+	}
+}
+
+func TestTextRenderer(t *testing.T) {
+	output := &bytes.Buffer{}
+	renderer := TextRenderer{Out: output, Err: output}
+
+	renderer.Render(&UploadEvent{Key: "about", MimeType: "text/html", Bytes: 12, DurationMs: 3})
+	renderer.Render(&RemoveEvent{Key: "old"})
+	renderer.Render(&InvalidationEvent{InvalidationID: "I1", Paths: []string{"/", "/about"}, Status: InvalidationCreated})
+	renderer.Render(&MessageEvent{Message: "wrote manifest m.json"})
+
+	expected := "> uploaded about - text/html (12 bytes in 3ms)\n> removed object old\n> created invalidation I1 for 2 paths\n> wrote manifest m.json\n"
+
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failures scripts may want to handle differently are wrapped in one of these, see
+// ExitCode for the status each one exits with.
+var (
+	ErrConfigNotFound     = errors.New("config not found")
+	ErrCredentialsMissing = errors.New("credentials missing")
+	ErrAccessDenied       = errors.New("bucket access denied")
+
+	// ErrPartialUpload means the bucket was changed but not every upload or removal
+	// succeeded, so it holds a mix of the old and new site.
+	ErrPartialUpload      = errors.New("partial upload")
+	ErrInvalidationFailed = errors.New("invalidation failed")
+)
+
+const (
+	ExitFailure            = 1
+	ExitConfigNotFound     = 3
+	ExitCredentialsMissing = 4
+	ExitAccessDenied       = 5
+	ExitPartialUpload      = 6
+	ExitInvalidationFailed = 7
+)
+
+// exitCodes is checked in order, so a partial upload caused by denied puts exits
+// with ExitPartialUpload since the bucket has already been changed.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrConfigNotFound, ExitConfigNotFound},
+	{ErrCredentialsMissing, ExitCredentialsMissing},
+	{ErrPartialUpload, ExitPartialUpload},
+	{ErrInvalidationFailed, ExitInvalidationFailed},
+	{ErrAccessDenied, ExitAccessDenied},
+}
+
+// ExitError exits with Code without printing anything, Err has already been reported
+// or is nil.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (err *ExitError) Error() string {
+	if err.Err == nil {
+		return fmt.Sprintf("exit status %d", err.Code)
+	}
+
+	return err.Err.Error()
+}
+
+func (err *ExitError) Unwrap() error {
+	return err.Err
+}
+
+// ExitCode is the status the process exits with for err, 0 when err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ExitError
+
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	for _, category := range exitCodes {
+		if errors.Is(err, category.err) {
+			return category.code
+		}
+	}
+
+	return ExitFailure
+}
+
+// checkAccess wraps errors S3 returned because the credentials may not access the bucket.
+func checkAccess(err error) error {
+	var apiErr interface{ ErrorCode() string }
+	var operationErr interface{ Service() string }
+
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "AccessDenied" || errors.Is(err, ErrAccessDenied) {
+		return err
+	}
+
+	// CloudFront denying a request says nothing about the bucket
+	if errors.As(err, &operationErr) && operationErr.Service() != "S3" {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestExitCode(t *testing.T) {
+	denied := checkAccess(&fakeaws.APIError{Code: "AccessDenied", Message: "Access Denied"})
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"success", nil, 0},
+		{"other failure", errors.New("failed"), ExitFailure},
+		{"config not found", fmt.Errorf("%w: no config with name prod", ErrConfigNotFound), ExitConfigNotFound},
+		{"credentials missing", fmt.Errorf("%w: no access key id provided", ErrCredentialsMissing), ExitCredentialsMissing},
+		{"access denied", denied, ExitAccessDenied},
+		{"partial upload", fmt.Errorf("%w: %w", ErrPartialUpload, denied), ExitPartialUpload},
+		{"invalidation failed", fmt.Errorf("%w: %w", ErrInvalidationFailed, errors.New("throttled")), ExitInvalidationFailed},
+		{"exit error", &ExitError{Code: 2, Err: ErrPartialUpload}, 2},
+	}
+
+	for _, test := range tests {
+		if code := ExitCode(test.err); code != test.expected {
+			t.Errorf("%s: expected exit code %d, got %d", test.name, test.expected, code)
+		}
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	denied := &fakeaws.APIError{Code: "AccessDenied", Message: "Access Denied"}
+
+	if err := checkAccess(denied); !errors.Is(err, ErrAccessDenied) || !errors.Is(err, denied) {
+		t.Errorf("expected AccessDenied to be wrapped, got %v", err)
+	}
+
+	if err := checkAccess(checkAccess(denied)); err.Error() != "bucket access denied: api error AccessDenied: Access Denied" {
+		t.Errorf("expected the error to be wrapped once, got %v", err)
+	}
+
+	other := &fakeaws.APIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+
+	if err := checkAccess(other); err != other {
+		t.Errorf("expected %v to be returned as is, got %v", other, err)
+	}
+}
+
+func TestRootExitCodes(t *testing.T) {
+	captureOutput(t)
+
+	// neither the real saved profiles nor a project file above the working directory are read
+	useConfigFile(t)
+	chdir(t, t.TempDir())
+
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+	empty := filepath.Join(t.TempDir(), "empty")
+
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(bucket *fakeaws.Bucket)
+		args     []string
+		expected int
+	}{
+		{
+			name:     "config not found",
+			args:     []string{"--config", "no-such-profile"},
+			expected: ExitConfigNotFound,
+		},
+		{
+			name:     "access denied",
+			setup:    func(bucket *fakeaws.Bucket) { bucket.DenyAccess() },
+			args:     []string{"--directory", dir},
+			expected: ExitAccessDenied,
+		},
+		{
+			name: "partial upload",
+			setup: func(bucket *fakeaws.Bucket) {
+				bucket.Put("removed", []byte("gone"), "text/html; charset=utf-8")
+				bucket.DenyDeletes("removed")
+			},
+			args:     []string{"--directory", dir, "--force"},
+			expected: ExitPartialUpload,
+		},
+		{
+			name:     "invalidation failed",
+			args:     []string{"--directory", dir, "--cf-invalidate"},
+			expected: ExitInvalidationFailed,
+		},
+		{
+			name:     "release switch failed",
+			args:     []string{"--directory", dir, "--release"},
+			expected: ExitInvalidationFailed,
+		},
+		{
+			name:     "refused removal",
+			setup:    func(bucket *fakeaws.Bucket) { bucket.Put("index.html", []byte("home"), "text/html") },
+			args:     []string{"--directory", empty},
+			expected: ExitFailure,
+		},
+	}
+
+	for _, test := range tests {
+		bucket := fakeaws.NewBucket("site")
+
+		if test.setup != nil {
+			test.setup(bucket)
+		}
+
+		// no distribution serves the bucket, so invalidating fails
+		err := executeRoot(bucket, fakeaws.NewDistributions(), test.args...)
+
+		if code := ExitCode(err); code != test.expected {
+			t.Errorf("%s: expected exit code %d, got %d (%v)", test.name, test.expected, code, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package fakeaws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// Distribution is a CloudFront distribution in front of one or more origins.
+type Distribution struct {
+	ID      string
+	Origins []Origin
+}
+
+type Origin struct {
+	DomainName string
+	OriginPath string
+}
+
+// Invalidation is a recorded CreateInvalidation call. Deployed is false when the
+// distribution was updated and not checked with GetDistribution since.
+type Invalidation struct {
+	ID             string
+	DistributionID string
+	Paths          []string
+	Deployed       bool
+}
+
+// Distributions is an in-memory CloudFront account. It is safe for concurrent use.
+type Distributions struct {
+	// PageSize limits the number of distributions returned per ListDistributions page, defaults to 100.
+	PageSize int
+
+	mu            sync.Mutex
+	distributions []Distribution
+	invalidations []Invalidation
+	versions      map[string]int
+	updating      map[string]bool
+}
+
+func NewDistributions(distributions ...Distribution) *Distributions {
+	return &Distributions{distributions: distributions, versions: map[string]int{}, updating: map[string]bool{}}
+}
+
+// Get returns a copy of the distribution with id, or nil.
+func (store *Distributions) Get(id string) *Distribution {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	distribution := store.find(id)
+
+	if distribution == nil {
+		return nil
+	}
+
+	copied := *distribution
+	copied.Origins = append([]Origin{}, distribution.Origins...)
+
+	return &copied
+}
+
+// Invalidations returns every invalidation created so far.
+func (store *Distributions) Invalidations() []Invalidation {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return append([]Invalidation{}, store.invalidations...)
+}
+
+func (store *Distributions) ListDistributions(ctx context.Context, params *cloudfront.ListDistributionsInput, optFns ...func(*cloudfront.Options)) (*cloudfront.ListDistributionsOutput, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	pageSize := store.PageSize
+
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	start := 0
+
+	if marker := aws.ToString(params.Marker); marker != "" {
+		for i, distribution := range store.distributions {
+			if distribution.ID == marker {
+				start = i
+			}
+		}
+	}
+
+	list := &types.DistributionList{IsTruncated: aws.Bool(false)}
+
+	for _, distribution := range store.distributions[start:] {
+		if len(list.Items) == pageSize {
+			list.IsTruncated = aws.Bool(true)
+			list.NextMarker = aws.String(distribution.ID)
+			break
+		}
+
+		list.Items = append(list.Items, distribution.summary())
+	}
+
+	list.Quantity = aws.Int32(int32(len(list.Items)))
+
+	return &cloudfront.ListDistributionsOutput{DistributionList: list}, nil
+}
+
+func (store *Distributions) CreateInvalidation(ctx context.Context, params *cloudfront.CreateInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.CreateInvalidationOutput, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	distributionID := aws.ToString(params.DistributionId)
+
+	if store.find(distributionID) == nil {
+		return nil, fmt.Errorf("NoSuchDistribution: %s", distributionID)
+	}
+
+	invalidation := Invalidation{
+		ID:             fmt.Sprintf("I%d", len(store.invalidations)+1),
+		DistributionID: distributionID,
+		Paths:          append([]string{}, params.InvalidationBatch.Paths.Items...),
+		Deployed:       !store.updating[distributionID],
+	}
+	store.invalidations = append(store.invalidations, invalidation)
+
+	return &cloudfront.CreateInvalidationOutput{
+		Invalidation: &types.Invalidation{
+			Id:                aws.String(invalidation.ID),
+			Status:            aws.String("InProgress"),
+			InvalidationBatch: params.InvalidationBatch,
+		},
+	}, nil
+}
+
+// GetInvalidation reports every invalidation as already completed.
+func (store *Distributions) GetInvalidation(ctx context.Context, params *cloudfront.GetInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.GetInvalidationOutput, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, invalidation := range store.invalidations {
+		if invalidation.ID == aws.ToString(params.Id) && invalidation.DistributionID == aws.ToString(params.DistributionId) {
+			return &cloudfront.GetInvalidationOutput{
+				Invalidation: &types.Invalidation{
+					Id:     aws.String(invalidation.ID),
+					Status: aws.String("Completed"),
+				},
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("NoSuchInvalidation: %s", aws.ToString(params.Id))
+}
+
+// GetDistribution reports every distribution as deployed, finishing any update.
+func (store *Distributions) GetDistribution(ctx context.Context, params *cloudfront.GetDistributionInput, optFns ...func(*cloudfront.Options)) (*cloudfront.GetDistributionOutput, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	distribution := store.find(aws.ToString(params.Id))
+
+	if distribution == nil {
+		return nil, fmt.Errorf("NoSuchDistribution: %s", aws.ToString(params.Id))
+	}
+
+	delete(store.updating, distribution.ID)
+
+	return &cloudfront.GetDistributionOutput{
+		Distribution: &types.Distribution{
+			Id:                 aws.String(distribution.ID),
+			Status:             aws.String("Deployed"),
+			DistributionConfig: &types.DistributionConfig{Origins: distribution.origins()},
+		},
+		ETag: aws.String(store.etag(distribution.ID)),
+	}, nil
+}
+
+func (store *Distributions) GetDistributionConfig(ctx context.Context, params *cloudfront.GetDistributionConfigInput, optFns ...func(*cloudfront.Options)) (*cloudfront.GetDistributionConfigOutput, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	distribution := store.find(aws.ToString(params.Id))
+
+	if distribution == nil {
+		return nil, fmt.Errorf("NoSuchDistribution: %s", aws.ToString(params.Id))
+	}
+
+	return &cloudfront.GetDistributionConfigOutput{
+		DistributionConfig: &types.DistributionConfig{Origins: distribution.origins()},
+		ETag:               aws.String(store.etag(distribution.ID)),
+	}, nil
+}
+
+// UpdateDistribution only applies origin paths, and like CloudFront rejects updates
+// whose IfMatch is not the ETag of the latest config.
+func (store *Distributions) UpdateDistribution(ctx context.Context, params *cloudfront.UpdateDistributionInput, optFns ...func(*cloudfront.Options)) (*cloudfront.UpdateDistributionOutput, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	distribution := store.find(aws.ToString(params.Id))
+
+	if distribution == nil {
+		return nil, fmt.Errorf("NoSuchDistribution: %s", aws.ToString(params.Id))
+	}
+
+	if aws.ToString(params.IfMatch) != store.etag(distribution.ID) {
+		return nil, fmt.Errorf("PreconditionFailed: %s is not the current ETag", aws.ToString(params.IfMatch))
+	}
+
+	for i, origin := range params.DistributionConfig.Origins.Items {
+		distribution.Origins[i].OriginPath = aws.ToString(origin.OriginPath)
+	}
+
+	store.versions[distribution.ID]++
+	store.updating[distribution.ID] = true
+
+	return &cloudfront.UpdateDistributionOutput{
+		Distribution: &types.Distribution{Id: aws.String(distribution.ID), DistributionConfig: params.DistributionConfig},
+		ETag:         aws.String(store.etag(distribution.ID)),
+	}, nil
+}
+
+func (store *Distributions) etag(id string) string {
+	return fmt.Sprintf("E%s-%d", id, store.versions[id])
+}
+
+func (store *Distributions) find(id string) *Distribution {
+	for i := range store.distributions {
+		if store.distributions[i].ID == id {
+			return &store.distributions[i]
+		}
+	}
+
+	return nil
+}
+
+func (distribution Distribution) origins() *types.Origins {
+	origins := &types.Origins{Quantity: aws.Int32(int32(len(distribution.Origins)))}
+
+	for i, origin := range distribution.Origins {
+		origins.Items = append(origins.Items, types.Origin{
+			Id:         aws.String(fmt.Sprintf("origin-%d", i)),
+			DomainName: aws.String(origin.DomainName),
+			OriginPath: aws.String(origin.OriginPath),
+		})
+	}
+
+	return origins
+}
+
+func (distribution Distribution) summary() types.DistributionSummary {
+	return types.DistributionSummary{
+		Id:      aws.String(distribution.ID),
+		Origins: distribution.origins(),
+	}
+}
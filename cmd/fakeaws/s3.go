@@ -0,0 +1,520 @@
+// Package fakeaws provides in-memory stand-ins for the S3 and CloudFront clients
+// so the deploy flow can be tested without AWS.
+package fakeaws
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Object is a stored object along with the metadata it was uploaded with.
+type Object struct {
+	Body               []byte
+	ETag               string
+	ContentType        string
+	ContentEncoding    string
+	CacheControl       string
+	ContentDisposition string
+	ContentLanguage    string
+	Expires            *time.Time
+	Metadata           map[string]string
+	LastModified       time.Time
+}
+
+// Bucket is an in-memory S3 bucket. It is safe for concurrent use.
+type Bucket struct {
+	Name string
+
+	// PageSize limits the number of keys returned per ListObjectsV2 page, defaults to 1000.
+	PageSize int
+
+	// OnPut is called with the key of every PutObject before it is stored, e.g. to cancel a
+	// run part way through.
+	OnPut func(key string)
+
+	mu          sync.Mutex
+	objects     map[string]*Object
+	puts        int
+	heads       int
+	denyDeletes map[string]bool
+	denyAccess  bool
+	uploads     map[string]*multipartUpload
+	uploadCount int
+	failParts   map[string]bool
+	failPuts    map[string]bool
+}
+
+type multipartUpload struct {
+	input *s3.CreateMultipartUploadInput
+	parts map[int32][]byte
+}
+
+func NewBucket(name string) *Bucket {
+	return &Bucket{
+		Name:        name,
+		objects:     map[string]*Object{},
+		denyDeletes: map[string]bool{},
+		uploads:     map[string]*multipartUpload{},
+		failParts:   map[string]bool{},
+		failPuts:    map[string]bool{},
+	}
+}
+
+// FailUploadParts makes every UploadPart call for keys fail.
+func (bucket *Bucket) FailUploadParts(keys ...string) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	for _, key := range keys {
+		bucket.failParts[key] = true
+	}
+}
+
+// FailPuts makes every PutObject call for keys fail.
+func (bucket *Bucket) FailPuts(keys ...string) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	for _, key := range keys {
+		bucket.failPuts[key] = true
+	}
+}
+
+// PendingUploads is the number of multipart uploads that were neither completed nor aborted.
+func (bucket *Bucket) PendingUploads() int {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	return len(bucket.uploads)
+}
+
+// DenyDeletes makes DeleteObjects report AccessDenied for keys instead of removing them.
+func (bucket *Bucket) DenyDeletes(keys ...string) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	for _, key := range keys {
+		bucket.denyDeletes[key] = true
+	}
+}
+
+// DenyAccess makes every request fail with AccessDenied, like credentials without any
+// permissions on the bucket.
+func (bucket *Bucket) DenyAccess() {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.denyAccess = true
+}
+
+// APIError is returned for requests S3 would reject with an error code.
+type APIError struct {
+	Code    string
+	Message string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("api error %s: %s", err.Code, err.Message)
+}
+
+func (err *APIError) ErrorCode() string {
+	return err.Code
+}
+
+func (err *APIError) ErrorMessage() string {
+	return err.Message
+}
+
+// SetLastModified changes the modification time of the object stored at key.
+func (bucket *Bucket) SetLastModified(key string, modified time.Time) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.objects[key].LastModified = modified
+}
+
+// Put stores an object directly, bypassing the client API.
+func (bucket *Bucket) Put(key string, body []byte, contentType string) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.objects[key] = newObject(body, contentType)
+}
+
+// Get returns the object stored at key, or nil.
+func (bucket *Bucket) Get(key string) *Object {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	return bucket.objects[key]
+}
+
+// Keys returns every stored key in sorted order.
+func (bucket *Bucket) Keys() []string {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	return bucket.sortedKeys("")
+}
+
+// PutCount is the number of PutObject calls that succeeded.
+func (bucket *Bucket) PutCount() int {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	return bucket.puts
+}
+
+// HeadCount is the number of HeadObject calls.
+func (bucket *Bucket) HeadCount() int {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	return bucket.heads
+}
+
+func (bucket *Bucket) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := bucket.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	pageSize := bucket.PageSize
+
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	keys := bucket.sortedKeys(aws.ToString(params.Prefix))
+	start := 0
+
+	if token := aws.ToString(params.ContinuationToken); token != "" {
+		start = sort.SearchStrings(keys, token)
+	}
+
+	output := &s3.ListObjectsV2Output{}
+	prefix, delimiter := aws.ToString(params.Prefix), aws.ToString(params.Delimiter)
+	lastCommon := ""
+
+	for _, key := range keys[start:] {
+		// keys sharing a common prefix are rolled up into a single entry
+		common := ""
+
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			common = key[:len(prefix)+i+len(delimiter)]
+
+			if common == lastCommon {
+				continue
+			}
+		}
+
+		if len(output.Contents)+len(output.CommonPrefixes) == pageSize {
+			output.IsTruncated = aws.Bool(true)
+			output.NextContinuationToken = aws.String(key)
+			break
+		}
+
+		if common != "" {
+			lastCommon = common
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(common)})
+			continue
+		}
+
+		obj := bucket.objects[key]
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.Body))),
+			ETag:         aws.String(`"` + obj.ETag + `"`),
+			LastModified: aws.Time(obj.LastModified),
+		})
+	}
+
+	output.KeyCount = aws.Int32(int32(len(output.Contents) + len(output.CommonPrefixes)))
+
+	return output, nil
+}
+
+func (bucket *Bucket) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := bucket.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.heads++
+	obj, exists := bucket.objects[aws.ToString(params.Key)]
+
+	if !exists {
+		return nil, &types.NotFound{Message: aws.String("Not Found")}
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentLength:   aws.Int64(int64(len(obj.Body))),
+		ContentType:     aws.String(obj.ContentType),
+		ContentEncoding: aws.String(obj.ContentEncoding),
+		CacheControl:    aws.String(obj.CacheControl),
+		ETag:            aws.String(`"` + obj.ETag + `"`),
+		Metadata:        obj.Metadata,
+		LastModified:    aws.Time(obj.LastModified),
+	}, nil
+}
+
+// SetCacheControl changes the Cache-Control header of the object stored at key.
+func (bucket *Bucket) SetCacheControl(key, cacheControl string) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.objects[key].CacheControl = cacheControl
+}
+
+func (bucket *Bucket) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := bucket.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	obj, exists := bucket.objects[aws.ToString(params.Key)]
+
+	if !exists {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	return &s3.GetObjectOutput{
+		Body:            io.NopCloser(bytes.NewReader(obj.Body)),
+		ContentLength:   aws.Int64(int64(len(obj.Body))),
+		ContentType:     aws.String(obj.ContentType),
+		ContentEncoding: aws.String(obj.ContentEncoding),
+		CacheControl:    aws.String(obj.CacheControl),
+		ETag:            aws.String(`"` + obj.ETag + `"`),
+		Metadata:        obj.Metadata,
+		LastModified:    aws.Time(obj.LastModified),
+	}, nil
+}
+
+func (bucket *Bucket) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := bucket.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+
+	if bucket.OnPut != nil {
+		bucket.OnPut(key)
+	}
+
+	bucket.mu.Lock()
+	fail := bucket.failPuts[key]
+	bucket.mu.Unlock()
+
+	if fail {
+		return nil, fmt.Errorf("put %s failed", key)
+	}
+
+	body, err := io.ReadAll(params.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	obj := newObject(body, aws.ToString(params.ContentType))
+	obj.ContentEncoding = aws.ToString(params.ContentEncoding)
+	obj.CacheControl = aws.ToString(params.CacheControl)
+	obj.ContentDisposition = aws.ToString(params.ContentDisposition)
+	obj.ContentLanguage = aws.ToString(params.ContentLanguage)
+	obj.Expires = params.Expires
+	obj.Metadata = params.Metadata
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.objects[key] = obj
+	bucket.puts++
+
+	return &s3.PutObjectOutput{ETag: aws.String(`"` + obj.ETag + `"`)}, nil
+}
+
+func (bucket *Bucket) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if err := bucket.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	output := &s3.DeleteObjectsOutput{}
+
+	for _, obj := range params.Delete.Objects {
+		if bucket.denyDeletes[aws.ToString(obj.Key)] {
+			output.Errors = append(output.Errors, types.Error{
+				Key:     obj.Key,
+				Code:    aws.String("AccessDenied"),
+				Message: aws.String("Access Denied"),
+			})
+			continue
+		}
+
+		delete(bucket.objects, aws.ToString(obj.Key))
+		output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+	}
+
+	return output, nil
+}
+
+func (bucket *Bucket) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if err := bucket.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.uploadCount++
+	uploadID := fmt.Sprintf("upload-%d", bucket.uploadCount)
+	bucket.uploads[uploadID] = &multipartUpload{input: params, parts: map[int32][]byte{}}
+
+	return &s3.CreateMultipartUploadOutput{Bucket: params.Bucket, Key: params.Key, UploadId: aws.String(uploadID)}, nil
+}
+
+func (bucket *Bucket) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(params.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	upload, exists := bucket.uploads[aws.ToString(params.UploadId)]
+
+	if !exists {
+		return nil, fmt.Errorf("NoSuchUpload: %s", aws.ToString(params.UploadId))
+	}
+
+	if bucket.failParts[aws.ToString(params.Key)] {
+		return nil, fmt.Errorf("InternalError: part %d failed", aws.ToInt32(params.PartNumber))
+	}
+
+	upload.parts[aws.ToInt32(params.PartNumber)] = body
+	sum := md5.Sum(body)
+
+	return &s3.UploadPartOutput{ETag: aws.String(`"` + hex.EncodeToString(sum[:]) + `"`)}, nil
+}
+
+func (bucket *Bucket) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	upload, exists := bucket.uploads[aws.ToString(params.UploadId)]
+
+	if !exists {
+		return nil, fmt.Errorf("NoSuchUpload: %s", aws.ToString(params.UploadId))
+	}
+
+	var body, sums []byte
+
+	for _, part := range params.MultipartUpload.Parts {
+		data, exists := upload.parts[aws.ToInt32(part.PartNumber)]
+
+		if !exists {
+			return nil, fmt.Errorf("InvalidPart: %d", aws.ToInt32(part.PartNumber))
+		}
+
+		sum := md5.Sum(data)
+		body = append(body, data...)
+		sums = append(sums, sum[:]...)
+	}
+
+	sum := md5.Sum(sums)
+	input := upload.input
+	obj := &Object{
+		Body:               body,
+		ETag:               fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(params.MultipartUpload.Parts)),
+		ContentType:        aws.ToString(input.ContentType),
+		ContentEncoding:    aws.ToString(input.ContentEncoding),
+		CacheControl:       aws.ToString(input.CacheControl),
+		ContentDisposition: aws.ToString(input.ContentDisposition),
+		ContentLanguage:    aws.ToString(input.ContentLanguage),
+		Expires:            input.Expires,
+		Metadata:           input.Metadata,
+	}
+
+	bucket.objects[aws.ToString(input.Key)] = obj
+	delete(bucket.uploads, aws.ToString(params.UploadId))
+
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"` + obj.ETag + `"`)}, nil
+}
+
+func (bucket *Bucket) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	if _, exists := bucket.uploads[aws.ToString(params.UploadId)]; !exists {
+		return nil, fmt.Errorf("NoSuchUpload: %s", aws.ToString(params.UploadId))
+	}
+
+	delete(bucket.uploads, aws.ToString(params.UploadId))
+
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (bucket *Bucket) checkBucket(name *string) error {
+	if aws.ToString(name) != bucket.Name {
+		return fmt.Errorf("NoSuchBucket: %s", aws.ToString(name))
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	if bucket.denyAccess {
+		return &APIError{Code: "AccessDenied", Message: "Access Denied"}
+	}
+
+	return nil
+}
+
+func (bucket *Bucket) sortedKeys(prefix string) []string {
+	keys := []string{}
+
+	for key := range bucket.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func newObject(body []byte, contentType string) *Object {
+	sum := md5.Sum(body)
+
+	return &Object{
+		Body:         body,
+		ETag:         hex.EncodeToString(sum[:]),
+		ContentType:  contentType,
+		LastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
@@ -2,11 +2,9 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"os/user"
 	"path/filepath"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,17 +15,35 @@ import (
 )
 
 func GetAWSConfig(accessKeyId, secretAccessKey, profile, region, roleName string, ctx context.Context) (string, aws.Config, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	profile, config, err := getAWSConfig(accessKeyId, secretAccessKey, profile, region, ctx)
 
 	if err != nil {
 		return "", aws.Config{}, err
 	}
 
+	// resolve now so missing credentials fail before any request, and say where they came from
+	if config.Credentials == nil {
+		return "", aws.Config{}, fmt.Errorf("%w: no credentials found", ErrCredentialsMissing)
+	}
+
+	creds, err := config.Credentials.Retrieve(ctx)
+
+	if err != nil {
+		return "", aws.Config{}, fmt.Errorf("%w: %w", ErrCredentialsMissing, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Using credentials from %s\n", creds.Source)
+
 	if roleName == "" {
 		return profile, config, nil
 	}
 
 	// handle role switching:
+	fmt.Fprintf(os.Stderr, "Assuming role %s\n", roleName)
 	stsClient := sts.NewFromConfig(config)
 	provider := stscreds.NewAssumeRoleProvider(stsClient, roleName)
 	config.Credentials = aws.NewCredentialsCache(provider)
@@ -37,24 +53,19 @@ func GetAWSConfig(accessKeyId, secretAccessKey, profile, region, roleName string
 
 func getAWSConfig(accessKeyId, secretAccessKey, profile, region string, ctx context.Context) (string, aws.Config, error) {
 	// load from profile OR use access key/secret access key (cannot supply both)
-	// otherwise, try to use the $AWS_PROFILE profile
+	// otherwise, try to use the $AWS_PROFILE profile, then the SDK's default credential chain
 
 	if profile != "" {
 		if accessKeyId != "" || secretAccessKey != "" {
 			return "", aws.Config{}, errors.New("cannot provide both profile and access key id/secret access key")
 		}
-		fmt.Printf("Using profile %s\n", profile)
-		c, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
-
-		if err == nil && c.Region == "" {
-			c.Region = region
-		}
+		fmt.Fprintf(os.Stderr, "Using profile %s\n", profile)
 
-		return profile, c, err
+		return loadProfile(profile, region, ctx)
 	}
 
 	if accessKeyId != "" && secretAccessKey != "" {
-		fmt.Println("Using access keys")
+		fmt.Fprintln(os.Stderr, "Using access keys")
 		return "", aws.Config{
 			Region: region,
 			Credentials: credentials.StaticCredentialsProvider{
@@ -69,58 +80,57 @@ func getAWSConfig(accessKeyId, secretAccessKey, profile, region string, ctx cont
 	profile = os.Getenv("AWS_PROFILE")
 
 	if profile != "" {
-		fmt.Printf("Using default profile %s\n", profile)
-		c, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
+		fmt.Fprintf(os.Stderr, "Using default profile %s\n", profile)
 
-		if err == nil && c.Region == "" {
-			c.Region = region
-		}
-
-		return profile, c, err
+		return loadProfile(profile, region, ctx)
 	}
 
-	accessKeyId, present := os.LookupEnv("AWS_ACCESS_KEY_ID")
+	return loadDefaultChain(region, ctx)
+}
 
-	if !present {
-		return "", aws.Config{}, errors.New("no access key id provided")
+// loadDefaultChain uses the SDK's default credential chain: the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables, a web identity token (GitHub OIDC),
+// the default shared profile with SSO or credential_process, then ECS or EC2 metadata.
+func loadDefaultChain(region string, ctx context.Context) (string, aws.Config, error) {
+	c, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+
+	if err != nil {
+		return "", aws.Config{}, fmt.Errorf("%w: %w", ErrCredentialsMissing, err)
 	}
 
-	secretAccessKey, present = os.LookupEnv("AWS_SECRET_ACCESS_KEY")
+	return "", c, nil
+}
+
+// loadProfile loads the shared config profile, a profile that does not exist or cannot be
+// read leaves no credentials to use.
+func loadProfile(profile, region string, ctx context.Context) (string, aws.Config, error) {
+	c, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
 
-	if !present {
-		return "", aws.Config{}, errors.New("no secret access key provided")
+	if err != nil {
+		return "", aws.Config{}, fmt.Errorf("%w: %w", ErrCredentialsMissing, err)
 	}
 
-	fmt.Println("Using access keys from environment variables")
-	return "", aws.Config{
-		Region: region,
-		Credentials: credentials.StaticCredentialsProvider{
-			Value: aws.Credentials{
-				AccessKeyID:     accessKeyId,
-				SecretAccessKey: secretAccessKey,
-			},
-		},
-	}, nil
+	if c.Region == "" {
+		c.Region = region
+	}
+
+	return profile, c, nil
 }
+
 func LoadConfigOptions() ([]SavedConfig, error) {
-	usr, err := user.Current()
+	store, err := NewProfileStore()
 
 	if err != nil {
 		return nil, err
 	}
 
-	homeDir := usr.HomeDir
-
-	configFile, err := os.Open(filepath.Join(homeDir, "sync-s3", "config.json"))
-
-	if err != nil {
-		return nil, errors.New("no config profiles found, create one using setup subcommand")
+	if _, err = os.Stat(store.Path); err != nil {
+		return nil, fmt.Errorf("%w: no config profiles found, create one using setup subcommand", ErrConfigNotFound)
 	}
 
-	savedConfig := SavedConfigFile{}
+	savedConfig, err := store.Load()
 
-	jsonParser := json.NewDecoder(configFile)
-	if err = jsonParser.Decode(&savedConfig); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
@@ -1,33 +1,138 @@
 package cmd
 
 import (
-	"log"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestGetAWSConfig(t *testing.T) {
+	isolateCredentials(t)
+
 	tests := []struct {
 		accessKeyId     string
 		secretAccessKey string
 		profile         string
 		region          string
-		expectedError   bool
+		expectedError   error
 	}{
-		{"", "", "", "", false},
+		{"", "", "", "", ErrCredentialsMissing},
 	}
 
 	for _, test := range tests {
 		_, creds, err := GetAWSConfig(test.accessKeyId, test.secretAccessKey, test.profile, test.region, "", nil)
 
-		if test.expectedError && err == nil {
-			log.Fatalf("Test did not fail")
-		}
-
-		if !test.expectedError && err != nil {
-			log.Fatalf("Test failed: %s", err)
+		if !errors.Is(err, test.expectedError) {
+			t.Fatalf("GetAWSConfig() error = %v, want %v", err, test.expectedError)
 		}
 
 		// TODO: test profile or keys set
 		_ = creds
 	}
 }
+
+// isolateCredentials hides the machine's shared config and metadata so only the test's
+// settings are found by the default chain.
+func isolateCredentials(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+}
+
+func TestGetAWSConfigCredentialChain(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		sharedConfig    string
+		accessKeyId     string
+		secretAccessKey string
+		expectedKey     string
+		expectedToken   string
+		expectedSource  string
+	}{
+		{
+			name:           "environment with session token",
+			env:            map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENV", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_SESSION_TOKEN": "token"},
+			expectedKey:    "AKIAENV",
+			expectedToken:  "token",
+			expectedSource: "EnvConfigCredentials",
+		},
+		{
+			name:            "explicit keys before environment",
+			env:             map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENV", "AWS_SECRET_ACCESS_KEY": "secret"},
+			accessKeyId:     "AKIAFLAG",
+			secretAccessKey: "secret",
+			expectedKey:     "AKIAFLAG",
+			expectedSource:  "StaticCredentials",
+		},
+		{
+			name:           "credential_process of the default profile",
+			sharedConfig:   "[default]\ncredential_process = printf '{\"Version\":1,\"AccessKeyId\":\"AKIAPROCESS\",\"SecretAccessKey\":\"secret\",\"SessionToken\":\"process-token\"}'\n",
+			expectedKey:    "AKIAPROCESS",
+			expectedToken:  "process-token",
+			expectedSource: "ProcessProvider",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolateCredentials(t)
+
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			if test.sharedConfig != "" {
+				if err := os.WriteFile(os.Getenv("AWS_CONFIG_FILE"), []byte(test.sharedConfig), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, awsConfig, err := GetAWSConfig(test.accessKeyId, test.secretAccessKey, "", "us-east-1", "", context.Background())
+
+			if err != nil {
+				t.Fatalf("GetAWSConfig() error = %v", err)
+			}
+
+			creds, err := awsConfig.Credentials.Retrieve(context.Background())
+
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+
+			if creds.AccessKeyID != test.expectedKey || creds.SessionToken != test.expectedToken {
+				t.Errorf("credentials = %q, %q, want %q, %q", creds.AccessKeyID, creds.SessionToken, test.expectedKey, test.expectedToken)
+			}
+
+			if creds.Source != test.expectedSource {
+				t.Errorf("Source = %q, want %q", creds.Source, test.expectedSource)
+			}
+
+			if awsConfig.Region != "us-east-1" {
+				t.Errorf("Region = %q, want us-east-1", awsConfig.Region)
+			}
+		})
+	}
+}
+
+func TestGetAWSConfigNoCredentials(t *testing.T) {
+	isolateCredentials(t)
+
+	_, _, err := GetAWSConfig("", "", "", "us-east-1", "", context.Background())
+
+	if !errors.Is(err, ErrCredentialsMissing) {
+		t.Errorf("GetAWSConfig() error = %v, want ErrCredentialsMissing", err)
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var globCache sync.Map
+
+// matchGlob reports whether name, a slash separated path relative to the site directory,
+// matches pattern. Patterns without a slash match the base name at any depth, a leading
+// slash anchors the pattern to the root and "**" matches across directories.
+func matchGlob(pattern, name string) bool {
+	re, ok := globCache.Load(pattern)
+
+	if !ok {
+		re, _ = globCache.LoadOrStore(pattern, globRegexp(pattern))
+	}
+
+	return re.(*regexp.Regexp).MatchString(name)
+}
+
+func globRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+
+	expr.WriteString("^")
+
+	if !anchored {
+		expr.WriteString("(.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+
+			class := pattern[i+1 : i+end]
+
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	// a pattern also matches everything inside a matching directory
+	expr.WriteString("(/.*)?$")
+
+	re, err := regexp.Compile(expr.String())
+
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+
+	return re
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.js", "app.js", true},
+		{"*.js", "assets/app.js", true},
+		{"*.js", "app.json", false},
+		{"/*.js", "assets/app.js", false},
+		{"assets/*.js", "assets/app.js", true},
+		{"assets/*.js", "assets/vendor/app.js", false},
+		{"assets/**/*.js", "assets/vendor/app.js", true},
+		{"assets/**/*.js", "assets/app.js", true},
+		{"**/*.map", "a/b/c.js.map", true},
+		{".git", ".git/HEAD", true},
+		{".git/", "sub/.git/config", true},
+		{"file?.txt", "file1.txt", true},
+		{"file[0-9].txt", "file7.txt", true},
+		{"file[!0-9].txt", "file7.txt", false},
+		{".DS_Store", "images/.DS_Store", true},
+	}
+
+	for _, test := range tests {
+		if got := matchGlob(test.pattern, test.name); got != test.expected {
+			t.Errorf("%s ~ %s: expected %v, got %v", test.pattern, test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const metadataHeaderPrefix = "x-amz-meta-"
+
+// HeaderRule sets HTTP headers on every uploaded file whose path matches Pattern.
+type HeaderRule struct {
+	Pattern            string            `json:"pattern"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	ContentLanguage    string            `json:"contentLanguage,omitempty"`
+	Expires            string            `json:"expires,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// ParseHeaderRule parses "<glob>:<header>=<value>", for example
+// "*.html:Cache-Control=no-cache" or "downloads/*:x-amz-meta-owner=docs".
+func ParseHeaderRule(value string) (HeaderRule, error) {
+	pattern, header, found := strings.Cut(value, ":")
+
+	if !found || pattern == "" {
+		return HeaderRule{}, fmt.Errorf("invalid header rule %q, expected <glob>:<header>=<value>", value)
+	}
+
+	name, headerValue, found := strings.Cut(header, "=")
+
+	if !found {
+		return HeaderRule{}, fmt.Errorf("invalid header rule %q, expected <glob>:<header>=<value>", value)
+	}
+
+	rule := HeaderRule{Pattern: pattern}
+	name = strings.ToLower(strings.TrimSpace(name))
+	headerValue = strings.TrimSpace(headerValue)
+
+	switch {
+	case name == "cache-control":
+		rule.CacheControl = headerValue
+	case name == "content-disposition":
+		rule.ContentDisposition = headerValue
+	case name == "content-language":
+		rule.ContentLanguage = headerValue
+	case name == "expires":
+		rule.Expires = headerValue
+	case strings.HasPrefix(name, metadataHeaderPrefix) && len(name) > len(metadataHeaderPrefix):
+		rule.Metadata = map[string]string{name[len(metadataHeaderPrefix):]: headerValue}
+	default:
+		return HeaderRule{}, fmt.Errorf("unsupported header %q in rule %q", name, value)
+	}
+
+	return rule, rule.Validate()
+}
+
+// String formats the rule the way it is given on the command line, with
+// multiple headers separated by "; ".
+func (rule HeaderRule) String() string {
+	var headers []string
+
+	for _, header := range []struct{ name, value string }{
+		{"Cache-Control", rule.CacheControl},
+		{"Content-Disposition", rule.ContentDisposition},
+		{"Content-Language", rule.ContentLanguage},
+		{"Expires", rule.Expires},
+	} {
+		if header.value != "" {
+			headers = append(headers, header.name+"="+header.value)
+		}
+	}
+
+	keys := make([]string, 0, len(rule.Metadata))
+
+	for key := range rule.Metadata {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		headers = append(headers, metadataHeaderPrefix+key+"="+rule.Metadata[key])
+	}
+
+	return rule.Pattern + ":" + strings.Join(headers, "; ")
+}
+
+func (rule HeaderRule) Validate() error {
+	if rule.Expires == "" {
+		return nil
+	}
+
+	_, err := parseExpires(rule.Expires)
+
+	return err
+}
+
+// applyHeaderRules sets the headers of every rule matching name on obj, later rules
+// overriding headers set by earlier ones.
+func applyHeaderRules(rules []HeaderRule, name string, obj *s3.PutObjectInput) error {
+	for _, rule := range rules {
+		if !matchGlob(rule.Pattern, name) {
+			continue
+		}
+
+		if rule.CacheControl != "" {
+			obj.CacheControl = aws.String(rule.CacheControl)
+		}
+
+		if rule.ContentDisposition != "" {
+			obj.ContentDisposition = aws.String(rule.ContentDisposition)
+		}
+
+		if rule.ContentLanguage != "" {
+			obj.ContentLanguage = aws.String(rule.ContentLanguage)
+		}
+
+		if rule.Expires != "" {
+			expires, err := parseExpires(rule.Expires)
+
+			if err != nil {
+				return err
+			}
+
+			obj.Expires = &expires
+		}
+
+		for key, value := range rule.Metadata {
+			if obj.Metadata == nil {
+				obj.Metadata = map[string]string{}
+			}
+
+			obj.Metadata[key] = value
+		}
+	}
+
+	return nil
+}
+
+func parseExpires(value string) (time.Time, error) {
+	for _, layout := range []string{http.TimeFormat, time.RFC3339} {
+		if expires, err := time.Parse(layout, value); err == nil {
+			return expires, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid Expires %q, use an HTTP date or RFC 3339 time", value)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestParseHeaderRule(t *testing.T) {
+	tests := []struct {
+		value         string
+		expected      HeaderRule
+		expectedError bool
+	}{
+		{"*.html:Cache-Control=no-cache", HeaderRule{Pattern: "*.html", CacheControl: "no-cache"}, false},
+		{"assets/*.js:cache-control=public, max-age=31536000, immutable", HeaderRule{Pattern: "assets/*.js", CacheControl: "public, max-age=31536000, immutable"}, false},
+		{"*.pdf:Content-Disposition=attachment", HeaderRule{Pattern: "*.pdf", ContentDisposition: "attachment"}, false},
+		{"de/*:Content-Language=de", HeaderRule{Pattern: "de/*", ContentLanguage: "de"}, false},
+		{"*:X-Amz-Meta-Owner=docs", HeaderRule{Pattern: "*", Metadata: map[string]string{"owner": "docs"}}, false},
+		{"*:Expires=Wed, 21 Oct 2015 07:28:00 GMT", HeaderRule{Pattern: "*", Expires: "Wed, 21 Oct 2015 07:28:00 GMT"}, false},
+		{"*:Expires=tomorrow", HeaderRule{}, true},
+		{"*:X-Frame-Options=DENY", HeaderRule{}, true},
+		{"Cache-Control=no-cache", HeaderRule{}, true},
+		{"*.html:Cache-Control", HeaderRule{}, true},
+	}
+
+	for _, test := range tests {
+		rule, err := ParseHeaderRule(test.value)
+
+		if test.expectedError {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.value)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(rule, test.expected) {
+			t.Errorf("%s: expected %v, got %v (%v)", test.value, test.expected, rule, err)
+		}
+	}
+}
+
+func TestApplyHeaderRules(t *testing.T) {
+	rules := []HeaderRule{
+		{Pattern: "*", CacheControl: "max-age=300", Metadata: map[string]string{"site": "docs"}},
+		{Pattern: "*.html", CacheControl: "no-cache"},
+		{Pattern: "assets/**", CacheControl: "public, max-age=31536000, immutable"},
+	}
+
+	tests := []struct {
+		name                 string
+		expectedCacheControl string
+	}{
+		{"index.html", "no-cache"},
+		{"blog/post.html", "no-cache"},
+		{"assets/js/app.123.js", "public, max-age=31536000, immutable"},
+		{"robots.txt", "max-age=300"},
+	}
+
+	for _, test := range tests {
+		obj := &s3.PutObjectInput{}
+
+		if err := applyHeaderRules(rules, test.name, obj); err != nil {
+			t.Fatal(err)
+		}
+
+		if aws.ToString(obj.CacheControl) != test.expectedCacheControl {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expectedCacheControl, aws.ToString(obj.CacheControl))
+		}
+
+		if obj.Metadata["site"] != "docs" {
+			t.Errorf("%s: expected metadata to be set, got %v", test.name, obj.Metadata)
+		}
+	}
+}
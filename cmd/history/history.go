@@ -0,0 +1,42 @@
+package history
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past deploys recorded in the bucket",
+	Long: `Lists the manifests written to <prefix>/.sync-s3/manifests/ after each successful sync,
+newest first, with the tool version, commit, profile and release of every deploy.
+
+Example Usage:
+	go run . history --bucket s3-bucket-name --limit 10
+`,
+	RunE: func(command *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		config, err := cmd.NewConfig(command, args)
+
+		if err != nil {
+			return err
+		}
+
+		limit, _ := command.Flags().GetInt("limit")
+
+		return cmd.History(config, limit, ctx)
+	},
+}
+
+func init() {
+	cmd.AddBucketFlags(historyCmd)
+	historyCmd.Flags().Int("limit", 20, "Number of deploys to show, 0 shows every deploy")
+
+	cmd.RootCmd.AddCommand(historyCmd)
+}
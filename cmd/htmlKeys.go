@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	HTMLStripExtension = "strip-extension"
+	HTMLDirectoryIndex = "directory-index"
+	HTMLBoth           = "both"
+	HTMLKeep           = "keep"
+)
+
+// DefaultHTMLExempt are the html files that keep their name under every strategy.
+var DefaultHTMLExempt = []string{"index.html", "error.html"}
+
+// KeyStrategy decides the object keys html files are uploaded under:
+//
+//	strip-extension  about.html -> about
+//	directory-index  about.html -> about/index.html
+//	both             about.html -> about and about/index.html
+//	keep             about.html -> about.html
+//
+// Files whose base name is in Exempt keep their name at any depth.
+type KeyStrategy struct {
+	Mode   string
+	Exempt []string
+}
+
+func DefaultKeyStrategy() KeyStrategy {
+	return KeyStrategy{Mode: HTMLStripExtension, Exempt: DefaultHTMLExempt}
+}
+
+func ValidateKeyStrategy(mode string) error {
+	switch mode {
+	case "", HTMLStripExtension, HTMLDirectoryIndex, HTMLBoth, HTMLKeep:
+		return nil
+	default:
+		return fmt.Errorf(
+			"unknown html key strategy %q, use one of %s, %s, %s or %s",
+			mode, HTMLStripExtension, HTMLDirectoryIndex, HTMLBoth, HTMLKeep,
+		)
+	}
+}
+
+// Keys returns the keys fileName (relative and slash separated) is uploaded under.
+// The zero value behaves like DefaultKeyStrategy.
+func (strategy KeyStrategy) Keys(fileName string) []string {
+	if strategy.Exempt == nil {
+		strategy.Exempt = DefaultHTMLExempt
+	}
+
+	if path.Ext(fileName) != ".html" || strategy.isExempt(fileName) {
+		return []string{fileName}
+	}
+
+	stripped := strings.TrimSuffix(fileName, ".html")
+
+	switch strategy.Mode {
+	case HTMLKeep:
+		return []string{fileName}
+	case HTMLDirectoryIndex:
+		return []string{stripped + "/index.html"}
+	case HTMLBoth:
+		return []string{stripped, stripped + "/index.html"}
+	default:
+		return []string{stripped}
+	}
+}
+
+func (strategy KeyStrategy) isExempt(fileName string) bool {
+	base := path.Base(fileName)
+
+	for _, exempt := range strategy.Exempt {
+		if base == exempt {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyStrategy(t *testing.T) {
+	tests := []struct {
+		strategy KeyStrategy
+		fileName string
+		expected []string
+	}{
+		{KeyStrategy{Mode: HTMLStripExtension}, "about.html", []string{"about"}},
+		{KeyStrategy{Mode: HTMLStripExtension}, "blog/index.html", []string{"blog/index.html"}},
+		{KeyStrategy{Mode: HTMLStripExtension}, "docs/error.html", []string{"docs/error.html"}},
+		{KeyStrategy{Mode: HTMLStripExtension, Exempt: []string{"404.html"}}, "index.html", []string{"index"}},
+		{KeyStrategy{Mode: HTMLStripExtension, Exempt: []string{"404.html"}}, "docs/404.html", []string{"docs/404.html"}},
+		{KeyStrategy{Mode: HTMLDirectoryIndex}, "about.html", []string{"about/index.html"}},
+		{KeyStrategy{Mode: HTMLDirectoryIndex}, "blog/post.html", []string{"blog/post/index.html"}},
+		{KeyStrategy{Mode: HTMLDirectoryIndex}, "index.html", []string{"index.html"}},
+		{KeyStrategy{Mode: HTMLBoth}, "about.html", []string{"about", "about/index.html"}},
+		{KeyStrategy{Mode: HTMLKeep}, "about.html", []string{"about.html"}},
+		{KeyStrategy{}, "about.html", []string{"about"}},
+		{KeyStrategy{}, "styles.css", []string{"styles.css"}},
+	}
+
+	for _, test := range tests {
+		if keys := test.strategy.Keys(test.fileName); !reflect.DeepEqual(keys, test.expected) {
+			t.Errorf("%s with %+v: expected %v, got %v", test.fileName, test.strategy, test.expected, keys)
+		}
+	}
+}
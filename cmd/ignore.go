@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SyncIgnoreFile is read from the root of the site directory if it exists.
+const SyncIgnoreFile = ".syncignore"
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+}
+
+// IgnoreRules decide which files are skipped, using gitignore style semantics:
+// rules are checked in order, the last matching rule wins and a leading "!"
+// re-includes files excluded by an earlier rule.
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+// LoadIgnoreRules reads the .syncignore file in directory (if any) followed by the
+// --exclude patterns and then the --include patterns, which re-include files.
+func LoadIgnoreRules(directory string, excludes, includes []string) (*IgnoreRules, error) {
+	ignore := &IgnoreRules{}
+	ignore.add("/" + SyncIgnoreFile)
+
+	if directory != "" {
+		if err := ignore.loadFile(filepath.Join(directory, SyncIgnoreFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pattern := range excludes {
+		ignore.add(pattern)
+	}
+
+	for _, pattern := range includes {
+		ignore.rules = append(ignore.rules, ignoreRule{pattern: pattern, negate: true})
+	}
+
+	return ignore, nil
+}
+
+func (ignore *IgnoreRules) loadFile(path string) error {
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ignore.add(line)
+	}
+
+	return scanner.Err()
+}
+
+func (ignore *IgnoreRules) add(pattern string) {
+	if strings.HasPrefix(pattern, "!") {
+		ignore.rules = append(ignore.rules, ignoreRule{pattern: pattern[1:], negate: true})
+		return
+	}
+
+	ignore.rules = append(ignore.rules, ignoreRule{pattern: pattern})
+}
+
+// Excluded reports whether name, slash separated and relative to the site directory
+// (or the prefix for remote keys), is ignored. A nil *IgnoreRules excludes nothing.
+func (ignore *IgnoreRules) Excluded(name string) bool {
+	if ignore == nil {
+		return false
+	}
+
+	excluded := false
+
+	for _, rule := range ignore.rules {
+		if matchGlob(rule.pattern, name) {
+			excluded = !rule.negate
+		}
+	}
+
+	return excluded
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	syncIgnore := "# build leftovers\n.DS_Store\n*.map\n!vendor.js.map\n\n.git/\n"
+
+	if err := os.WriteFile(filepath.Join(dir, SyncIgnoreFile), []byte(syncIgnore), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ignore, err := LoadIgnoreRules(dir, []string{"drafts/**", "/robots.txt"}, []string{"drafts/ready.html"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{".syncignore", true},
+		{"index.html", false},
+		{"images/.DS_Store", true},
+		{"app.js.map", true},
+		{"assets/vendor.js.map", false},
+		{".git", true},
+		{".git/config", true},
+		{"drafts/post.html", true},
+		{"drafts/ready.html", false},
+		{"robots.txt", true},
+		{"blog/robots.txt", false},
+	}
+
+	for _, test := range tests {
+		if got := ignore.Excluded(test.name); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestIgnoreRulesWithoutFile(t *testing.T) {
+	ignore, err := LoadIgnoreRules(t.TempDir(), nil, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ignore.Excluded("index.html") {
+		t.Errorf("expected nothing to be excluded")
+	}
+
+	var none *IgnoreRules
+
+	if none.Excluded("index.html") {
+		t.Errorf("expected nil rules to exclude nothing")
+	}
+}
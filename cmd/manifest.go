@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// ReservedDirectory holds the deploy manifests under the prefix. Keys in it are
+	// never diffed against the local directory or removed.
+	ReservedDirectory = ".sync-s3/"
+
+	latestManifest    = "latest.json"
+	manifestDirectory = "manifests/"
+	manifestFormat    = 1
+)
+
+// Version is the version of the tool, set at build time with
+// -ldflags "-X github.com/alrudolph/snyc-static-site-s3/cmd.Version=v1.2.3".
+var Version = "dev"
+
+// Manifest records what a deploy left in the bucket. GitSHA and Profile are only recorded
+// with --manifest-details, since the manifest is stored under the served prefix.
+type Manifest struct {
+	Format      int              `json:"format"`
+	DeployedAt  time.Time        `json:"deployedAt"`
+	ToolVersion string           `json:"toolVersion"`
+	GitSHA      string           `json:"gitSha,omitempty"`
+	Profile     string           `json:"profile,omitempty"`
+	Bucket      string           `json:"bucket"`
+	Prefix      string           `json:"prefix"`
+	Release     string           `json:"release,omitempty"`
+	Objects     []ManifestObject `json:"objects"`
+}
+
+// ManifestObject is an object of a deploy. Headers is the headerHash of the headers it was
+// uploaded with, so --from-manifest can notice changed header rules.
+type ManifestObject struct {
+	Key         string `json:"key"`
+	ETag        string `json:"etag"`
+	ContentType string `json:"contentType,omitempty"`
+	Headers     string `json:"headers,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+func manifestRoot(prefix string) string {
+	return listPrefix(prefix) + ReservedDirectory
+}
+
+func isReserved(key, prefix string) bool {
+	return strings.HasPrefix(key, manifestRoot(prefix))
+}
+
+// NewManifest lists every object the sync left under the prefix: the uploaded and
+// unchanged files along with protected objects, which have no known content type.
+func NewManifest(userInput *Config, prefix string, plan *SyncPlan, now time.Time) *Manifest {
+	manifest := &Manifest{
+		Format:      manifestFormat,
+		DeployedAt:  now.UTC(),
+		ToolVersion: Version,
+		Bucket:      userInput.Bucket,
+		Prefix:      prefix,
+		Objects:     []ManifestObject{},
+	}
+
+	if userInput.ManifestDetails {
+		manifest.GitSHA = gitSHA(userInput.Directory)
+		manifest.Profile = userInput.ConfigName
+	}
+
+	if userInput.Release.Enabled {
+		manifest.Release = userInput.Release.ID
+	}
+
+	options := userInput.UploadOptions()
+
+	for _, file := range append(plan.Uploads(), plan.Unchanged...) {
+		// the header rules were validated before anything was uploaded
+		headers, _ := headerHash(file, options)
+		manifest.Objects = append(manifest.Objects, ManifestObject{Key: file.Key, ETag: file.ETag, ContentType: file.MimeType, Headers: headers, Size: file.Size})
+	}
+
+	for _, obj := range plan.Protected {
+		manifest.Objects = append(manifest.Objects, ManifestObject{Key: obj.Key, ETag: obj.ETag, Size: obj.Size})
+	}
+
+	sort.Slice(manifest.Objects, func(i, j int) bool {
+		return manifest.Objects[i].Key < manifest.Objects[j].Key
+	})
+
+	return manifest
+}
+
+// gitSHA is the commit being deployed, taken from CI or from the repository containing
+// the directory. It is empty when neither is available.
+func gitSHA(directory string) string {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha
+	}
+
+	if directory == "" {
+		return ""
+	}
+
+	output, err := exec.Command("git", "-C", directory, "rev-parse", "HEAD").Output()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// WriteManifest stores manifest in the history and as the latest manifest of the prefix.
+func WriteManifest(manifest *Manifest, basePrefix string, client S3API, ctx context.Context) error {
+	body, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	root := manifestRoot(basePrefix)
+	name := manifest.DeployedAt.Format("20060102T150405.000000000Z") + ".json"
+
+	for _, key := range []string{root + manifestDirectory + name, root + latestManifest} {
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:       aws.String(manifest.Bucket),
+			Key:          aws.String(key),
+			Body:         bytes.NewReader(body),
+			ContentType:  aws.String("application/json"),
+			CacheControl: aws.String("no-cache"),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	message("wrote manifest %s%s", root+manifestDirectory, name)
+
+	return nil
+}
+
+// ListManifests returns the keys of every stored manifest, oldest first.
+func ListManifests(bucket, prefix string, client S3API, ctx context.Context) ([]string, error) {
+	objects, err := ListRemoteObjects(bucket, manifestRoot(prefix)+manifestDirectory, client, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+
+	for key := range objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// ReadManifest loads the manifest stored at key.
+func ReadManifest(bucket, key string, client S3API, ctx context.Context) (*Manifest, error) {
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer output.Body.Close()
+
+	manifest := &Manifest{}
+
+	if err = json.NewDecoder(output.Body).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", key, err)
+	}
+
+	return manifest, nil
+}
+
+// LatestManifest returns the manifest of the last deploy to prefix, or nil if there is none.
+func LatestManifest(bucket, prefix string, client S3API, ctx context.Context) (*Manifest, error) {
+	manifest, err := ReadManifest(bucket, manifestRoot(prefix)+latestManifest, client, ctx)
+
+	var noSuchKey *types.NoSuchKey
+
+	if errors.As(err, &noSuchKey) {
+		return nil, nil
+	}
+
+	return manifest, err
+}
+
+// RemoveLatestManifest deletes the latest manifest of prefix, keeping the history.
+func RemoveLatestManifest(bucket, prefix string, client S3API, ctx context.Context) error {
+	key := manifestRoot(prefix) + latestManifest
+
+	output, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{Objects: []types.ObjectIdentifier{{Key: aws.String(key)}}},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(output.Errors) > 0 {
+		return fmt.Errorf("failed to remove %s: %s", key, aws.ToString(output.Errors[0].Message))
+	}
+
+	return nil
+}
+
+// manifestObjects returns the remote objects recorded by the latest manifest for prefix,
+// or nil when there is no manifest that describes the prefix or it disagrees with the bucket.
+func manifestObjects(bucket, prefix string, client S3API, ctx context.Context) (map[string]RemoteObject, error) {
+	manifest, err := LatestManifest(bucket, prefix, client, ctx)
+
+	if err != nil || manifest == nil || manifest.Prefix != prefix {
+		return nil, err
+	}
+
+	objects := map[string]RemoteObject{}
+
+	for _, obj := range manifest.Objects {
+		objects[obj.Key] = RemoteObject{Key: obj.Key, Size: obj.Size, ETag: obj.ETag, Headers: obj.Headers}
+	}
+
+	matches, err := matchesListing(objects, bucket, prefix, client, ctx)
+
+	if err != nil || !matches {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// matchesListing checks the manifest objects against the first page of the listing, so a
+// bucket changed behind the tool's back is noticed without listing every object. Listed
+// keys missing from the manifest are fine, they are left alone like with --preserve.
+func matchesListing(objects map[string]RemoteObject, bucket, prefix string, client S3API, ctx context.Context) (bool, error) {
+	page, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(listPrefix(prefix)),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	listed := map[string]string{}
+	last := ""
+
+	for _, obj := range page.Contents {
+		listed[aws.ToString(obj.Key)] = aws.ToString(obj.ETag)
+		last = aws.ToString(obj.Key)
+	}
+
+	for key, obj := range objects {
+		// keys after the first page were not listed
+		if aws.ToBool(page.IsTruncated) && key > last {
+			continue
+		}
+
+		if etag, exists := listed[key]; !exists || strings.Trim(etag, `"`) != obj.ETag {
+			message("manifest does not match the bucket at %s, listing the bucket instead", key)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// PrintHistory lists the newest limit manifests, or every manifest if limit is 0.
+func PrintHistory(bucket, prefix string, limit int, client S3API, ctx context.Context) error {
+	keys, err := ListManifests(bucket, prefix, client, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		fmt.Printf("No deploys recorded under s3://%s/%s\n", bucket, manifestRoot(prefix))
+		return nil
+	}
+
+	if limit > 0 && len(keys) > limit {
+		keys = keys[len(keys)-limit:]
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		manifest, err := ReadManifest(bucket, keys[i], client, ctx)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s  %d objects  version %s", manifest.DeployedAt.Format(time.RFC3339), len(manifest.Objects), manifest.ToolVersion)
+
+		for _, field := range []struct{ name, value string }{
+			{"commit", manifest.GitSHA},
+			{"profile", manifest.Profile},
+			{"release", manifest.Release},
+		} {
+			if field.value != "" {
+				fmt.Printf("  %s %s", field.name, field.value)
+			}
+		}
+
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// History connects with the credentials of userInput and prints its deploy history.
+func History(userInput *Config, limit int, ctx context.Context) error {
+	awsConfig, err := connect(userInput, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return checkAccess(PrintHistory(userInput.Bucket, userInput.Prefix, limit, newS3Client(awsConfig), ctx))
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestRootManifest(t *testing.T) {
+	t.Setenv("GITHUB_SHA", "abc123")
+
+	dir := writeSite(t, map[string]string{"index.html": "home", "about.html": "about"})
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("docs/.well-known/token", []byte("token"), "")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--prefix", "docs", "--preserve", ".well-known/**", "--manifest-details")
+
+	manifest := &Manifest{}
+
+	if err := json.Unmarshal(bucket.Get("docs/.sync-s3/latest.json").Body, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.GitSHA != "abc123" || manifest.ToolVersion != Version || manifest.Prefix != "docs" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	// both pages are uploaded with the same headers, the preserved object was not uploaded by us
+	headers := ""
+
+	if len(manifest.Objects) == 3 {
+		headers = manifest.Objects[1].Headers
+	}
+
+	if headers == "" {
+		t.Errorf("expected the manifest to record the headers of the pages")
+	}
+
+	expected := []ManifestObject{
+		{Key: "docs/.well-known/token", ETag: bucket.Get("docs/.well-known/token").ETag, Size: 5},
+		{Key: "docs/about", ETag: bucket.Get("docs/about").ETag, ContentType: "text/html; charset=utf-8", Headers: headers, Size: 5},
+		{Key: "docs/index.html", ETag: bucket.Get("docs/index.html").ETag, ContentType: "text/html; charset=utf-8", Headers: headers, Size: 4},
+	}
+
+	if !reflect.DeepEqual(manifest.Objects, expected) {
+		t.Errorf("expected objects %v, got %v", expected, manifest.Objects)
+	}
+
+	// the manifests are never removed by the next sync
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--prefix", "docs", "--preserve", ".well-known/**")
+
+	keys, err := ListManifests("site", "docs", bucket, context.Background())
+
+	if err != nil || len(keys) != 2 {
+		t.Errorf("expected two manifests in the history, got %v (%v)", keys, err)
+	}
+
+	// the manifest is served with the site, so the commit is only recorded when asked for
+	if latest, err := LatestManifest("site", "docs", bucket, context.Background()); err != nil || latest.GitSHA != "" {
+		t.Errorf("expected no commit in the manifest without --manifest-details, got %+v (%v)", latest, err)
+	}
+}
+
+func TestRootFromManifest(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+
+	// written behind the tool's back, so the manifest does not know about it
+	bucket.Put("unmanaged", []byte("x"), "")
+	puts := bucket.PutCount()
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--from-manifest")
+
+	if bucket.Get("unmanaged") == nil {
+		t.Errorf("expected keys missing from the manifest to be left alone")
+	}
+
+	if uploads := bucket.PutCount() - puts - 2; uploads != 0 {
+		t.Errorf("expected no uploads when the manifest matches, got %d", uploads)
+	}
+
+	if heads := bucket.HeadCount(); heads != 0 {
+		t.Errorf("expected no HeadObject calls without header rules, got %d", heads)
+	}
+}
+
+func TestRootFromManifestHeaderRuleChange(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home", "assets/app.js": "app"})
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+
+	puts := bucket.PutCount()
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--from-manifest",
+		"--header", "assets/*:Cache-Control=public, max-age=31536000, immutable",
+	)
+
+	if cacheControl := bucket.Get("assets/app.js").CacheControl; cacheControl != "public, max-age=31536000, immutable" {
+		t.Errorf("expected assets/app.js to be re-uploaded as immutable, got %q", cacheControl)
+	}
+
+	if uploads := bucket.PutCount() - puts - 2; uploads != 1 {
+		t.Errorf("expected only assets/app.js to be uploaded, got %d", uploads)
+	}
+
+	// the manifest recorded the headers, so nothing has to be asked of S3
+	if heads := bucket.HeadCount(); heads != 0 {
+		t.Errorf("expected no HeadObject calls, got %d", heads)
+	}
+}
+
+func TestRootFromManifestAfterEmptying(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home", "about.html": "about"})
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--force")
+
+	if bucket.Get(".sync-s3/latest.json") != nil {
+		t.Errorf("expected emptying the bucket to remove the latest manifest")
+	}
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--from-manifest")
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, []string{"about", "index.html"}) {
+		t.Errorf("expected the site to be uploaded into the emptied bucket, got %v", keys)
+	}
+}
+
+func TestRootFromManifestOutOfDate(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home", "about.html": "about"})
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+
+	// changed behind the tool's back, so the manifest no longer describes the bucket
+	bucket.Put("about", []byte("edited"), "text/html; charset=utf-8")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--from-manifest")
+
+	if body := string(bucket.Get("about").Body); body != "about" {
+		t.Errorf("expected about to be uploaded again when the manifest does not match the bucket, got %q", body)
+	}
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	MiB = 1024 * 1024
+
+	DefaultMultipartThreshold = 64 * MiB
+	DefaultPartSize           = 16 * MiB
+	DefaultPartConcurrency    = 4
+
+	// limits imposed by S3
+	minPartSize = 5 * MiB
+	maxParts    = 10000
+
+	abortTimeout = 30 * time.Second
+)
+
+// MultipartOptions controls when and how large files are uploaded in parts.
+type MultipartOptions struct {
+	Threshold   int64
+	PartSize    int64
+	Concurrency int
+}
+
+func (options MultipartOptions) withDefaults() MultipartOptions {
+	if options.Threshold <= 0 {
+		options.Threshold = DefaultMultipartThreshold
+	}
+
+	if options.PartSize < minPartSize {
+		options.PartSize = DefaultPartSize
+	}
+
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultPartConcurrency
+	}
+
+	return options
+}
+
+func (options MultipartOptions) useMultipart(size int64) bool {
+	return size >= options.withDefaults().Threshold
+}
+
+// partSize grows the configured part size when needed to stay within the S3 part limit.
+func (options MultipartOptions) partSize(size int64) int64 {
+	partSize := options.withDefaults().PartSize
+
+	for (size+partSize-1)/partSize > maxParts {
+		partSize *= 2
+	}
+
+	return partSize
+}
+
+// multipartETag computes the ETag S3 assigns to an object uploaded in parts of partSize:
+// the MD5 of the concatenated part MD5s followed by the number of parts.
+func multipartETag(body io.Reader, partSize int64) (string, error) {
+	var sums []byte
+	parts := 0
+
+	for {
+		hash := md5.New()
+		n, err := io.CopyN(hash, body, partSize)
+
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		if n == 0 && parts > 0 {
+			break
+		}
+
+		sums = append(sums, hash.Sum(nil)...)
+		parts++
+
+		if n < partSize {
+			break
+		}
+	}
+
+	sum := md5.Sum(sums)
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
+
+// uploadMultipart uploads body in parts using the headers from obj. If any part fails the
+// upload is aborted so the parts that were already stored are not kept around.
+func uploadMultipart(obj *s3.PutObjectInput, body io.ReaderAt, size int64, options MultipartOptions, client S3API, ctx context.Context) error {
+	options = options.withDefaults()
+	partSize := options.partSize(size)
+
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             obj.Bucket,
+		Key:                obj.Key,
+		ContentType:        obj.ContentType,
+		ContentEncoding:    obj.ContentEncoding,
+		CacheControl:       obj.CacheControl,
+		ContentDisposition: obj.ContentDisposition,
+		ContentLanguage:    obj.ContentLanguage,
+		Expires:            obj.Expires,
+		Metadata:           obj.Metadata,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	parts, err := uploadParts(obj, created.UploadId, body, size, partSize, options.Concurrency, client, ctx)
+
+	if err == nil {
+		_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          obj.Bucket,
+			Key:             obj.Key,
+			UploadId:        created.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	// ctx may already be cancelled, the abort should still go through
+	abortCtx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	_, abortErr := client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:   obj.Bucket,
+		Key:      obj.Key,
+		UploadId: created.UploadId,
+	})
+
+	if abortErr != nil {
+		return fmt.Errorf("%w (aborting upload %s also failed: %s)", err, aws.ToString(created.UploadId), abortErr)
+	}
+
+	return err
+}
+
+func uploadParts(obj *s3.PutObjectInput, uploadID *string, body io.ReaderAt, size, partSize int64, concurrency int, client S3API, ctx context.Context) ([]types.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int32)
+	var parts []types.CompletedPart
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for partNumber := range jobs {
+				offset := int64(partNumber-1) * partSize
+				length := partSize
+
+				if offset+length > size {
+					length = size - offset
+				}
+
+				output, err := client.UploadPart(ctx, &s3.UploadPartInput{
+					Bucket:     obj.Bucket,
+					Key:        obj.Key,
+					UploadId:   uploadID,
+					PartNumber: aws.Int32(partNumber),
+					Body:       io.NewSectionReader(body, offset, length),
+				})
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("part %d: %w", partNumber, err)
+					cancel()
+				} else if err == nil {
+					parts = append(parts, types.CompletedPart{ETag: output.ETag, PartNumber: aws.Int32(partNumber)})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	numParts := int32((size + partSize - 1) / partSize)
+
+	for partNumber := int32(1); partNumber <= numParts && ctx.Err() == nil; partNumber++ {
+		jobs <- partNumber
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr == nil && len(parts) != int(numParts) {
+		firstErr = ctx.Err()
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+
+	return parts, nil
+}
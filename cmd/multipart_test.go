@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestUploadMultipart(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), (minPartSize*2+MiB)/10)
+	options := MultipartOptions{Threshold: minPartSize, PartSize: minPartSize, Concurrency: 2}
+
+	bucket := fakeaws.NewBucket("site")
+	obj := &s3.PutObjectInput{
+		Bucket:       aws.String("site"),
+		Key:          aws.String("video.mp4"),
+		ContentType:  aws.String("video/mp4"),
+		CacheControl: aws.String("max-age=60"),
+	}
+
+	if err := uploadMultipart(obj, bytes.NewReader(body), int64(len(body)), options, bucket, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := bucket.Get("video.mp4")
+
+	if !bytes.Equal(stored.Body, body) || stored.ContentType != "video/mp4" || stored.CacheControl != "max-age=60" {
+		t.Fatalf("object was not stored correctly (%d bytes, %s, %s)", len(stored.Body), stored.ContentType, stored.CacheControl)
+	}
+
+	etag, err := multipartETag(bytes.NewReader(body), options.partSize(int64(len(body))))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if etag != stored.ETag {
+		t.Errorf("expected ETag %s, got %s", stored.ETag, etag)
+	}
+}
+
+func TestUploadMultipartAbortsOnFailure(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), minPartSize*2)
+	options := MultipartOptions{Threshold: minPartSize, PartSize: minPartSize}
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.FailUploadParts("data.bin")
+
+	obj := &s3.PutObjectInput{Bucket: aws.String("site"), Key: aws.String("data.bin")}
+
+	if err := uploadMultipart(obj, bytes.NewReader(body), int64(len(body)), options, bucket, context.Background()); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+
+	if bucket.PendingUploads() != 0 {
+		t.Errorf("expected the failed upload to be aborted")
+	}
+
+	if bucket.Get("data.bin") != nil {
+		t.Errorf("expected no object to be stored")
+	}
+}
+
+func TestPartSize(t *testing.T) {
+	options := MultipartOptions{PartSize: minPartSize}
+
+	if size := options.partSize(maxParts * minPartSize); size != minPartSize {
+		t.Errorf("expected %d, got %d", minPartSize, size)
+	}
+
+	if size := options.partSize(maxParts*minPartSize + 1); size != 2*minPartSize {
+		t.Errorf("expected %d, got %d", 2*minPartSize, size)
+	}
+}
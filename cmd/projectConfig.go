@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileNames are looked for in the working directory and every directory above it.
+// Unlike saved profiles a project file can be checked in, since it never holds credentials.
+var ProjectFileNames = []string{"sync-s3.yaml", "sync-s3.yml", "sync-s3.toml"}
+
+// credentialKeys are rejected in project files, compared after lowercasing and dropping
+// '-' and '_', so accessKeyId, access-key-id and access_key_id all match.
+var credentialKeys = map[string]bool{
+	"accesskeyid":        true,
+	"secretaccesskey":    true,
+	"sessiontoken":       true,
+	"awsaccesskeyid":     true,
+	"awssecretaccesskey": true,
+	"awssessiontoken":    true,
+}
+
+type ProjectFile struct {
+	// Path is where the file was found, relative directories in it are resolved
+	// against the directory containing it.
+	Path         string                        `yaml:"-" toml:"-"`
+	Environments map[string]ProjectEnvironment `yaml:"environments" toml:"environments"`
+}
+
+// ProjectEnvironment is a named deploy target of a project file. Credentials come from the
+// profile, role or environment variables, never from the file.
+type ProjectEnvironment struct {
+	Bucket         string   `yaml:"bucket" toml:"bucket"`
+	Prefix         string   `yaml:"prefix" toml:"prefix"`
+	Region         string   `yaml:"region" toml:"region"`
+	Profile        string   `yaml:"profile" toml:"profile"`
+	Role           string   `yaml:"role" toml:"role"`
+	Directory      string   `yaml:"directory" toml:"directory"`
+	DistributionID string   `yaml:"distributionId" toml:"distributionId"`
+	Invalidate     bool     `yaml:"invalidate" toml:"invalidate"`
+	Headers        []string `yaml:"headers" toml:"headers"`
+	HTMLKeys       string   `yaml:"htmlKeys" toml:"htmlKeys"`
+	HTMLExempt     []string `yaml:"htmlExempt" toml:"htmlExempt"`
+	Exclude        []string `yaml:"exclude" toml:"exclude"`
+	Include        []string `yaml:"include" toml:"include"`
+	Preserve       []string `yaml:"preserve" toml:"preserve"`
+	Compress       string   `yaml:"compress" toml:"compress"`
+	CompressTypes  []string `yaml:"compressTypes" toml:"compressTypes"`
+}
+
+// FindProjectFile returns the path of the project file closest to dir, or "" if neither
+// dir nor any directory above it has one.
+func FindProjectFile(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range ProjectFileNames {
+			path := filepath.Join(dir, name)
+
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+
+		if parent == dir {
+			return "", nil
+		}
+
+		dir = parent
+	}
+}
+
+// LoadProjectFile reads the project file closest to dir, or returns nil if there is none.
+func LoadProjectFile(dir string) (*ProjectFile, error) {
+	path, err := FindProjectFile(dir)
+
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := ParseProjectFile(filepath.Ext(path), data)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid project file %s: %w", path, err)
+	}
+
+	project.Path = path
+
+	return project, nil
+}
+
+// ParseProjectFile decodes a project file with the given extension, .toml or .yaml/.yml.
+// Unknown keys are an error so typos don't silently deploy with defaults.
+func ParseProjectFile(ext string, data []byte) (*ProjectFile, error) {
+	var raw struct {
+		Environments map[string]map[string]any `yaml:"environments" toml:"environments"`
+	}
+	project := &ProjectFile{}
+
+	switch ext {
+	case ".toml":
+		if _, err := toml.Decode(string(data), &raw); err != nil {
+			return nil, err
+		}
+
+		if err := checkCredentials(raw.Environments); err != nil {
+			return nil, err
+		}
+
+		metadata, err := toml.Decode(string(data), project)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown key %s", undecoded[0])
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+
+		if err := checkCredentials(raw.Environments); err != nil {
+			return nil, err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		// an empty file has no document to decode
+		if err := decoder.Decode(project); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported project file extension %q", ext)
+	}
+
+	return project, nil
+}
+
+func checkCredentials(environments map[string]map[string]any) error {
+	names := make([]string, 0, len(environments))
+
+	for name := range environments {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for key := range environments[name] {
+			normalized := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(key))
+
+			if credentialKeys[normalized] {
+				return fmt.Errorf("environment %s sets %s, credentials must not be stored in a project file, use a profile, role or environment variables", name, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Config turns the environment into a config, resolving its directory against the
+// directory of the project file.
+func (project *ProjectFile) Config(name string) (*Config, error) {
+	env, ok := project.Environments[name]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: no environment %s in %s", ErrConfigNotFound, name, project.Path)
+	}
+
+	if env.Bucket == "" {
+		return nil, fmt.Errorf("environment %s in %s has no bucket", name, project.Path)
+	}
+
+	directory := env.Directory
+
+	if directory != "" && !filepath.IsAbs(directory) {
+		directory = filepath.Join(filepath.Dir(project.Path), directory)
+	}
+
+	config := &Config{
+		Region:         env.Region,
+		Profile:        env.Profile,
+		Role:           env.Role,
+		Bucket:         env.Bucket,
+		Prefix:         env.Prefix,
+		Directory:      directory,
+		CfInvalidate:   env.Invalidate,
+		DistributionID: env.DistributionID,
+		Keys:           KeyStrategy{Mode: env.HTMLKeys, Exempt: env.HTMLExempt},
+		Exclude:        env.Exclude,
+		Include:        env.Include,
+		Preserve:       env.Preserve,
+		Compression:    CompressOptions{Encoding: env.Compress, Types: env.CompressTypes},
+	}
+
+	for _, header := range env.Headers {
+		rule, err := ParseHeaderRule(header)
+
+		if err != nil {
+			return nil, fmt.Errorf("environment %s in %s: %w", name, project.Path, err)
+		}
+
+		config.Headers = append(config.Headers, rule)
+	}
+
+	return config, nil
+}
+
+// LoadConfig loads the config named name, from the environments of the project file
+// first and then from the profiles saved for the working directory.
+func LoadConfig(name string) (*Config, error) {
+	project, err := LoadProjectFile(".")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if project != nil {
+		if _, ok := project.Environments[name]; ok {
+			return project.Config(name)
+		}
+	}
+
+	config, err := LoadConfigFromFile(name)
+
+	if project != nil && errors.Is(err, ErrConfigNotFound) {
+		return nil, fmt.Errorf("%w: no environment %s in %s and no saved config with that name", ErrConfigNotFound, name, project.Path)
+	}
+
+	return config, err
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	cwd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+}
+
+const projectYAML = `
+environments:
+  staging:
+    bucket: site
+    prefix: staging
+    directory: build
+    headers:
+      - "*.html:Cache-Control=no-cache"
+    exclude:
+      - "*.map"
+  production:
+    bucket: site-prod
+    region: eu-west-1
+    role: arn:aws:iam::123456789012:role/deploy
+    distributionId: E123
+    invalidate: true
+`
+
+const projectTOML = `
+[environments.staging]
+bucket = "site"
+prefix = "staging"
+directory = "build"
+headers = ["*.html:Cache-Control=no-cache"]
+exclude = ["*.map"]
+
+[environments.production]
+bucket = "site-prod"
+region = "eu-west-1"
+role = "arn:aws:iam::123456789012:role/deploy"
+distributionId = "E123"
+invalidate = true
+`
+
+func TestParseProjectFile(t *testing.T) {
+	expected := map[string]ProjectEnvironment{
+		"staging": {
+			Bucket:    "site",
+			Prefix:    "staging",
+			Directory: "build",
+			Headers:   []string{"*.html:Cache-Control=no-cache"},
+			Exclude:   []string{"*.map"},
+		},
+		"production": {
+			Bucket:         "site-prod",
+			Region:         "eu-west-1",
+			Role:           "arn:aws:iam::123456789012:role/deploy",
+			DistributionID: "E123",
+			Invalidate:     true,
+		},
+	}
+
+	for _, test := range []struct{ ext, data string }{
+		{".yaml", projectYAML},
+		{".toml", projectTOML},
+	} {
+		project, err := ParseProjectFile(test.ext, []byte(test.data))
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.ext, err)
+		}
+
+		if !reflect.DeepEqual(project.Environments, expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.ext, expected, project.Environments)
+		}
+	}
+}
+
+func TestParseProjectFileErrors(t *testing.T) {
+	tests := []struct {
+		name, ext, data, expected string
+	}{
+		{"yaml credentials", ".yaml", "environments:\n  prod:\n    bucket: site\n    accessKeyId: AKIA\n", "credentials must not be stored"},
+		{"toml credentials", ".toml", "[environments.prod]\nbucket = \"site\"\nsecret_access_key = \"s\"\n", "credentials must not be stored"},
+		{"yaml unknown key", ".yaml", "environments:\n  prod:\n    bucktet: site\n", "bucktet"},
+		{"toml unknown key", ".toml", "[environments.prod]\nbucktet = \"site\"\n", "bucktet"},
+		{"extension", ".json", "{}", "unsupported"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseProjectFile(test.ext, []byte(test.data))
+
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestFindProjectFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "src", "pages")
+
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := FindProjectFile(nested); err != nil || path != "" {
+		t.Fatalf("expected no project file, got %q (%v)", path, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "sync-s3.toml"), []byte(projectTOML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := FindProjectFile(nested); err != nil || path != filepath.Join(root, "sync-s3.toml") {
+		t.Errorf("expected the project file in %s, got %q (%v)", root, path, err)
+	}
+}
+
+func TestProjectConfig(t *testing.T) {
+	project, err := ParseProjectFile(".yaml", []byte(projectYAML))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project.Path = filepath.Join("/repo", "sync-s3.yaml")
+	config, err := project.Config("staging")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Directory != filepath.Join("/repo", "build") || config.Prefix != "staging" || len(config.Headers) != 1 {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	if _, err = project.Config("qa"); !errors.Is(err, ErrConfigNotFound) {
+		t.Errorf("expected a missing environment to be ErrConfigNotFound, got %v", err)
+	}
+}
+
+func TestRootProjectEnvironment(t *testing.T) {
+	captureOutput(t)
+	isolateCredentials(t)
+
+	root := writeSite(t, map[string]string{
+		"sync-s3.yaml":      projectYAML,
+		"build/index.html":  "home",
+		"build/app.js.map":  "map",
+		"src/app/README.md": "source",
+	})
+	chdir(t, filepath.Join(root, "src", "app"))
+
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--config", "staging")
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, []string{"staging/index.html"}) {
+		t.Errorf("expected only staging/index.html, got %v", keys)
+	}
+
+	if obj := bucket.Get("staging/index.html"); obj == nil || obj.CacheControl != "no-cache" {
+		t.Errorf("expected the header rule of the environment to apply, got %+v", obj)
+	}
+}
+
+func TestRootProjectEnvironmentCredentialFlags(t *testing.T) {
+	captureOutput(t)
+	isolateCredentials(t)
+
+	root := writeSite(t, map[string]string{
+		"sync-s3.yaml": `
+environments:
+  staging:
+    bucket: site
+    directory: build
+    profile: does-not-exist
+`,
+		"build/index.html": "home",
+	})
+	chdir(t, root)
+
+	bucket := fakeaws.NewBucket("site")
+
+	// executeRoot passes --access-key-id and --secret-access-key, which replace the profile
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--config", "staging")
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, []string{"index.html"}) {
+		t.Errorf("expected index.html, got %v", keys)
+	}
+}
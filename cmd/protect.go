@@ -0,0 +1,27 @@
+package cmd
+
+import "strings"
+
+// ProtectRules decide which remote keys are never removed: keys in the reserved directory,
+// keys matching an ignore rule and keys matching one of the Preserve globs. Keys are
+// matched relative to the prefix.
+type ProtectRules struct {
+	Ignore   *IgnoreRules
+	Preserve []string
+}
+
+func (rules ProtectRules) Protects(key, prefix string) bool {
+	name := strings.TrimPrefix(key, listPrefix(prefix))
+
+	if strings.HasPrefix(name, ReservedDirectory) || rules.Ignore.Excluded(name) {
+		return true
+	}
+
+	for _, pattern := range rules.Preserve {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
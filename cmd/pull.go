@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// LocalFileName maps a key under prefix back to the file it was uploaded from. html
+// objects without an extension get their .html extension back. It returns "" for keys
+// that are not files, like folder markers.
+func LocalFileName(key, prefix, contentType string) (string, error) {
+	name := strings.TrimPrefix(key, listPrefix(prefix))
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		return "", nil
+	}
+
+	mimeType, _, _ := strings.Cut(contentType, ";")
+
+	if path.Ext(name) == "" && strings.TrimSpace(mimeType) == "text/html" {
+		name += ".html"
+	}
+
+	cleaned := path.Clean(name)
+
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("key %s points outside of the directory", key)
+	}
+
+	return filepath.FromSlash(cleaned), nil
+}
+
+// PullDirectory downloads every object under prefix into directory, keeping the
+// objects' modification times and undoing any compression applied on upload.
+func PullDirectory(bucket, prefix, directory string, concurrency int, client S3API, ctx context.Context) error {
+	objects, err := ListRemoteObjects(bucket, prefix, client, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects))
+
+	for key := range objects {
+		if !isReserved(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	jobs := make(chan string)
+	var failures []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for key := range jobs {
+				err := ctx.Err()
+
+				if err == nil {
+					err = downloadObject(bucket, key, prefix, directory, client, ctx)
+				}
+
+				if err != nil {
+					mu.Lock()
+					failures = append(failures, fmt.Errorf("%s: %w", key, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		jobs <- key
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	message("downloaded %d files, %d failed", len(keys)-len(failures), len(failures))
+
+	return errors.Join(failures...)
+}
+
+func downloadObject(bucket, key, prefix, directory string, client S3API, ctx context.Context) error {
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer output.Body.Close()
+
+	name, err := LocalFileName(key, prefix, aws.ToString(output.ContentType))
+
+	if err != nil || name == "" {
+		return err
+	}
+
+	message("downloading %s to %s", key, name)
+
+	body, err := decompressBody(output.Body, aws.ToString(output.ContentEncoding))
+
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	filePath := filepath.Join(directory, name)
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	if output.LastModified == nil {
+		return nil
+	}
+
+	return os.Chtimes(filePath, *output.LastModified, *output.LastModified)
+}
+
+// decompressBody decodes body according to its Content-Encoding. Closing the result does
+// not close body.
+func decompressBody(body io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewReader(body)
+	case EncodingBrotli:
+		return io.NopCloser(brotli.NewReader(body)), nil
+	default:
+		return io.NopCloser(body), nil
+	}
+}
+
+// Pull connects with the credentials of userInput and downloads its prefix into its directory.
+func Pull(userInput *Config, ctx context.Context) error {
+	awsConfig, err := connect(userInput, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return checkAccess(PullDirectory(userInput.Bucket, userInput.Prefix, userInput.Directory, userInput.Concurrency, newS3Client(awsConfig), ctx))
+}
@@ -0,0 +1,49 @@
+package pull
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Download the files under a bucket prefix into a local directory",
+	Long: `Downloads every object under the prefix into a directory, the reverse of a sync.
+html objects uploaded without their extension are written as .html files again, compressed
+objects are decompressed and every file keeps the modification time of its object.
+
+The directory always has to be given, so a saved profile never pulls over its own site.
+
+Example Usage:
+	go run . pull --bucket s3-bucket-name --directory ./live-site
+`,
+	RunE: func(command *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		config, err := cmd.NewConfig(command, args)
+
+		if err != nil {
+			return err
+		}
+
+		// a saved profile's directory is the site source, never pull over it
+		config.Directory, _ = command.Flags().GetString("directory")
+
+		return cmd.Pull(config, ctx)
+	},
+}
+
+func init() {
+	cmd.AddBucketFlags(pullCmd)
+	pullCmd.Flags().StringP("directory", "d", "", "Directory to download the files into")
+	_ = pullCmd.MarkFlagDirname("directory")
+	_ = pullCmd.MarkFlagRequired("directory")
+	pullCmd.Flags().Int("concurrency", cmd.DefaultConcurrency, "Number of files to download at the same time")
+
+	cmd.RootCmd.AddCommand(pullCmd)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestLocalFileName(t *testing.T) {
+	tests := []struct {
+		key, prefix, contentType string
+		expected                 string
+		fails                    bool
+	}{
+		{"about", "", "text/html; charset=utf-8", "about.html", false},
+		{"docs/blog/post", "docs", "text/html", filepath.Join("blog", "post.html"), false},
+		{"index.html", "", "text/html; charset=utf-8", "index.html", false},
+		{"LICENSE", "", "text/plain", "LICENSE", false},
+		{"css/styles.css", "", "text/css", filepath.Join("css", "styles.css"), false},
+		{"docs/assets/", "docs", "", "", false},
+		{"../escape", "", "text/plain", "", true},
+	}
+
+	for _, test := range tests {
+		name, err := LocalFileName(test.key, test.prefix, test.contentType)
+
+		if test.fails != (err != nil) || name != test.expected {
+			t.Errorf("LocalFileName(%q, %q): expected %q, got %q (%v)", test.key, test.prefix, test.expected, name, err)
+		}
+	}
+}
+
+func TestPullRoundTrip(t *testing.T) {
+	site := map[string]string{
+		"index.html":      "<h1>home</h1>",
+		"about.html":      "<h1>about</h1>",
+		"blog/post.html":  "<h1>post</h1>",
+		"css/styles.css":  "body {}",
+		"images/logo.png": "png",
+	}
+
+	bucket := fakeaws.NewBucket("site")
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", writeSite(t, site), "--prefix", "docs", "--compress", "gzip")
+
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	bucket.SetLastModified("docs/about", modified)
+
+	dir := t.TempDir()
+	output := captureOutput(t)
+
+	if err := PullDirectory("site", "docs", dir, 2, bucket, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.String(), "> downloaded 5 files, 0 failed") {
+		t.Errorf("expected the progress to go through the reporter, got %q", output.String())
+	}
+
+	for name, content := range site {
+		body, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+
+		if err != nil || string(body) != content {
+			t.Errorf("expected %s to contain %q, got %q (%v)", name, content, body, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ReservedDirectory)); !os.IsNotExist(err) {
+		t.Errorf("expected the manifests not to be downloaded")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "about.html"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("expected about.html to keep its modification time, got %v", info.ModTime())
+	}
+}
@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	ReleasesDirectory = "releases"
+
+	// CurrentReleaseKey holds the ID of the live release, relative to the releases directory.
+	CurrentReleaseKey = "current"
+
+	SwitchOrigin  = "origin"
+	SwitchPointer = "pointer"
+
+	DefaultKeepReleases = 5
+
+	deployWaitTimeout = 30 * time.Minute
+)
+
+var releaseIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ReleaseOptions enable atomic deploys: the site is uploaded under
+// <prefix>/releases/<id>/ and traffic is switched once every file is in place.
+type ReleaseOptions struct {
+	Enabled bool
+	ID      string
+	Switch  string
+	Keep    int
+}
+
+// NewReleaseID returns a timestamp based ID, so IDs sort in the order they were deployed.
+func NewReleaseID(now time.Time) string {
+	return now.UTC().Format("20060102T150405Z")
+}
+
+func ValidateReleaseID(id string) error {
+	if !releaseIDPattern.MatchString(id) || id == CurrentReleaseKey {
+		return fmt.Errorf("invalid release id %q, use letters, digits, '.', '_' or '-'", id)
+	}
+
+	return nil
+}
+
+func ValidateSwitch(mode string) error {
+	switch mode {
+	case SwitchOrigin, SwitchPointer:
+		return nil
+	default:
+		return fmt.Errorf("unsupported switch %q, use %s or %s", mode, SwitchOrigin, SwitchPointer)
+	}
+}
+
+// releasesRoot is the key prefix every release is stored under, ending with a slash.
+func releasesRoot(prefix string) string {
+	return listPrefix(path.Join(strings.Trim(prefix, "/"), ReleasesDirectory))
+}
+
+// ReleasePrefix is the prefix the files of release id are uploaded to.
+func ReleasePrefix(prefix, id string) string {
+	return releasesRoot(prefix) + id
+}
+
+// ListReleases returns the IDs of every release under prefix in sorted order.
+func ListReleases(bucket, prefix string, client S3API, ctx context.Context) ([]string, error) {
+	root := releasesRoot(prefix)
+	var releases []string
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(root),
+		Delimiter: aws.String("/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, common := range page.CommonPrefixes {
+			releases = append(releases, strings.TrimSuffix(strings.TrimPrefix(aws.ToString(common.Prefix), root), "/"))
+		}
+	}
+
+	sort.Strings(releases)
+
+	return releases, nil
+}
+
+// CurrentRelease reads the release ID from the pointer object, or returns "" if no
+// release was switched to yet.
+func CurrentRelease(bucket, prefix string, client S3API, ctx context.Context) (string, error) {
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(releasesRoot(prefix) + CurrentReleaseKey),
+	})
+
+	var noSuchKey *types.NoSuchKey
+
+	if errors.As(err, &noSuchKey) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	defer output.Body.Close()
+
+	body, err := io.ReadAll(output.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// DeployRelease syncs the directory into a new release, switches traffic to it once
+// every upload succeeded and then removes all but the newest releases.
+func DeployRelease(userInput *Config, client S3API, cfClient CloudFrontAPI, ctx context.Context) error {
+	release := userInput.Release
+	releasePrefix := ReleasePrefix(userInput.Prefix, release.ID)
+
+	message("deploying release %s to s3://%s/%s", release.ID, userInput.Bucket, releasePrefix)
+
+	plan, err := SyncDirectory(userInput.Directory, userInput.Bucket, releasePrefix, userInput.UploadOptions(), client, ctx)
+
+	if err != nil {
+		message("not switching to the release since the sync failed")
+		return err
+	}
+
+	if err = SwitchRelease(userInput, release.ID, client, cfClient, ctx); err != nil {
+		return err
+	}
+
+	if err = WriteManifest(NewManifest(userInput, releasePrefix, plan, time.Now()), userInput.Prefix, client, ctx); err != nil {
+		return err
+	}
+
+	return PruneReleases(userInput.Bucket, userInput.Prefix, release.Keep, release.ID, client, ctx)
+}
+
+// SwitchRelease points traffic at release id by rewriting the pointer object and, with
+// the origin switch, the origin path of the distribution serving the bucket.
+func SwitchRelease(userInput *Config, id string, client S3API, cfClient CloudFrontAPI, ctx context.Context) error {
+	if userInput.Release.Switch == SwitchOrigin {
+		distributionID, _, err := ResolveDistributionID(userInput, cfClient, ctx)
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+		}
+
+		originPath := "/" + ReleasePrefix(userInput.Prefix, id)
+
+		if err = SetOriginPath(distributionID, userInput.Bucket, userInput.Prefix, originPath, cfClient, ctx); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+		}
+
+		message("switched distribution %s to origin path %s", distributionID, originPath)
+
+		// edges still on the old origin path would re-cache the previous release
+		if err = WaitForDeployment(distributionID, cfClient, ctx); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+		}
+
+		// every path now resolves to the new release
+		invalidation, err := CreateInvalidation(distributionID, []string{"/*"}, cfClient, ctx)
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+		}
+
+		emit(&InvalidationEvent{
+			DistributionID: distributionID,
+			InvalidationID: aws.ToString(invalidation.Invalidation.Id),
+			Paths:          []string{"/*"},
+			Status:         InvalidationCreated,
+		})
+
+		if userInput.WaitInvalidation {
+			if err = WaitForInvalidation(distributionID, invalidation, cfClient, ctx); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
+			}
+		}
+	}
+
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(userInput.Bucket),
+		Key:          aws.String(releasesRoot(userInput.Prefix) + CurrentReleaseKey),
+		Body:         strings.NewReader(id + "\n"),
+		ContentType:  aws.String("text/plain; charset=utf-8"),
+		CacheControl: aws.String("no-cache"),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	message("current release is now %s", id)
+
+	return nil
+}
+
+// RollbackRelease switches traffic back to a release that is still stored in the bucket.
+func RollbackRelease(userInput *Config, id string, client S3API, cfClient CloudFrontAPI, ctx context.Context) error {
+	if err := ValidateReleaseID(id); err != nil {
+		return err
+	}
+
+	releases, err := ListReleases(userInput.Bucket, userInput.Prefix, client, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if i := sort.SearchStrings(releases, id); i == len(releases) || releases[i] != id {
+		return fmt.Errorf("release %s not found under s3://%s/%s", id, userInput.Bucket, releasesRoot(userInput.Prefix))
+	}
+
+	return SwitchRelease(userInput, id, client, cfClient, ctx)
+}
+
+// releasesByAge returns the IDs of every release under prefix, oldest first. A release is
+// as old as its last uploaded object, since custom IDs like git SHAs do not sort by time.
+func releasesByAge(bucket, prefix string, client S3API, ctx context.Context) ([]string, error) {
+	root := releasesRoot(prefix)
+	uploaded := map[string]time.Time{}
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(root),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			id, _, found := strings.Cut(strings.TrimPrefix(aws.ToString(obj.Key), root), "/")
+
+			// the pointer object is not part of a release
+			if !found {
+				continue
+			}
+
+			if modified := aws.ToTime(obj.LastModified); !modified.Before(uploaded[id]) {
+				uploaded[id] = modified
+			}
+		}
+	}
+
+	releases := make([]string, 0, len(uploaded))
+
+	for id := range uploaded {
+		releases = append(releases, id)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		if !uploaded[releases[i]].Equal(uploaded[releases[j]]) {
+			return uploaded[releases[i]].Before(uploaded[releases[j]])
+		}
+
+		return releases[i] < releases[j]
+	})
+
+	return releases, nil
+}
+
+// PruneReleases removes all but the newest keep releases, never removing current.
+// A keep of 0 or less keeps every release.
+func PruneReleases(bucket, prefix string, keep int, current string, client S3API, ctx context.Context) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	releases, err := releasesByAge(bucket, prefix, client, ctx)
+
+	if err != nil || len(releases) <= keep {
+		return err
+	}
+
+	for _, id := range releases[:len(releases)-keep] {
+		if id == current {
+			continue
+		}
+
+		objects, err := ListRemoteObjects(bucket, ReleasePrefix(prefix, id), client, ctx)
+
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(objects))
+
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+
+		message("removing release %s (%d objects)", id, len(keys))
+
+		if err = DeleteObjects(bucket, keys, client, ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WaitForDeployment blocks until every edge location serves the latest config of the distribution.
+func WaitForDeployment(distributionID string, client CloudFrontAPI, ctx context.Context) error {
+	message("waiting for distribution %s to deploy", distributionID)
+
+	waiter := cloudfront.NewDistributionDeployedWaiter(client)
+
+	return waiter.Wait(ctx, &cloudfront.GetDistributionInput{Id: aws.String(distributionID)}, deployWaitTimeout)
+}
+
+// SetOriginPath updates every origin of the distribution that serves prefix of the
+// bucket, either directly or through a release, to originPath.
+func SetOriginPath(distributionID, bucket, prefix, originPath string, client CloudFrontAPI, ctx context.Context) error {
+	current, err := client.GetDistributionConfig(ctx, &cloudfront.GetDistributionConfigInput{
+		Id: aws.String(distributionID),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	config := current.DistributionConfig
+	updated := 0
+
+	if config.Origins != nil {
+		for i, origin := range config.Origins.Items {
+			if isBucketOrigin(aws.ToString(origin.DomainName), bucket) && servesPrefix(aws.ToString(origin.OriginPath), prefix) {
+				config.Origins.Items[i].OriginPath = aws.String(originPath)
+				updated++
+			}
+		}
+	}
+
+	if updated == 0 {
+		return fmt.Errorf("distribution %s has no origin serving s3://%s/%s", distributionID, bucket, prefix)
+	}
+
+	_, err = client.UpdateDistribution(ctx, &cloudfront.UpdateDistributionInput{
+		Id:                 aws.String(distributionID),
+		IfMatch:            current.ETag,
+		DistributionConfig: config,
+	})
+
+	return err
+}
+
+// servesPrefix reports whether an origin path points at prefix or one of its releases.
+func servesPrefix(originPath, prefix string) bool {
+	originPath = strings.Trim(originPath, "/")
+
+	return originPath == strings.Trim(prefix, "/") || strings.HasPrefix(originPath+"/", releasesRoot(prefix))
+}
+
+// Rollback connects with the credentials of userInput and switches back to release id,
+// or lists the stored releases when list is set.
+func Rollback(userInput *Config, id string, list bool, ctx context.Context) error {
+	awsConfig, err := connect(userInput, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	client := newS3Client(awsConfig)
+
+	if list {
+		return checkAccess(PrintReleases(userInput.Bucket, userInput.Prefix, client, ctx))
+	}
+
+	return checkAccess(RollbackRelease(userInput, id, client, newCloudFrontClient(awsConfig), ctx))
+}
+
+// PrintReleases lists every stored release, marking the current one.
+func PrintReleases(bucket, prefix string, client S3API, ctx context.Context) error {
+	releases, err := ListReleases(bucket, prefix, client, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	current, err := CurrentRelease(bucket, prefix, client, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(releases) == 0 {
+		fmt.Printf("No releases under s3://%s/%s\n", bucket, releasesRoot(prefix))
+		return nil
+	}
+
+	for _, id := range releases {
+		if id == current {
+			fmt.Printf("* %s (current)\n", id)
+		} else {
+			fmt.Printf("  %s\n", id)
+		}
+	}
+
+	return nil
+}
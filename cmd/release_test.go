@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+func TestRootRelease(t *testing.T) {
+	bucket := fakeaws.NewBucket("site")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "SITE", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com", OriginPath: "/docs"}}},
+	)
+
+	for _, id := range []string{"r1", "r2", "r3"} {
+		dir := writeSite(t, map[string]string{"index.html": "home " + id})
+		runRoot(t, bucket, distributions, "--directory", dir, "--prefix", "docs", "--release", "--release-id", id, "--keep-releases", "2")
+	}
+
+	expected := []string{"docs/releases/current", "docs/releases/r2/index.html", "docs/releases/r3/index.html"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	if body := string(bucket.Get("docs/releases/current").Body); body != "r3\n" {
+		t.Errorf("expected the pointer to name r3, got %q", body)
+	}
+
+	if path := distributions.Get("SITE").Origins[0].OriginPath; path != "/docs/releases/r3" {
+		t.Errorf("expected the origin to point at r3, got %s", path)
+	}
+
+	invalidations := distributions.Invalidations()
+
+	if len(invalidations) != 3 || !reflect.DeepEqual(invalidations[2].Paths, []string{"/*"}) {
+		t.Errorf("expected every switch to invalidate /*, got %v", invalidations)
+	}
+
+	for _, invalidation := range invalidations {
+		if !invalidation.Deployed {
+			t.Errorf("expected invalidation %s to wait for the new origin path to deploy", invalidation.ID)
+		}
+	}
+
+	userInput := &Config{Bucket: "site", Prefix: "docs", Release: ReleaseOptions{Switch: SwitchOrigin}}
+
+	if err := RollbackRelease(userInput, "r2", bucket, distributions, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := distributions.Get("SITE").Origins[0].OriginPath; path != "/docs/releases/r2" {
+		t.Errorf("expected the rollback to point the origin at r2, got %s", path)
+	}
+
+	if err := RollbackRelease(userInput, "r1", bucket, distributions, context.Background()); err == nil {
+		t.Errorf("expected rolling back to a pruned release to fail")
+	}
+}
+
+func TestReleasePointerSwitch(t *testing.T) {
+	bucket := fakeaws.NewBucket("site")
+	distributions := fakeaws.NewDistributions()
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+
+	runRoot(t, bucket, distributions, "--directory", dir, "--release", "--release-id", "v1", "--switch", "pointer")
+
+	current, err := CurrentRelease("site", "", bucket, context.Background())
+
+	if err != nil || current != "v1" {
+		t.Errorf("expected current release v1, got %q (%v)", current, err)
+	}
+
+	if len(distributions.Invalidations()) != 0 {
+		t.Errorf("expected the pointer switch to leave CloudFront alone")
+	}
+}
+
+func TestListReleases(t *testing.T) {
+	bucket := fakeaws.NewBucket("site")
+	bucket.PageSize = 2
+
+	for _, key := range []string{"releases/b/index.html", "releases/b/about", "releases/a/index.html", "releases/c/index.html", "releases/current", "index.html"} {
+		bucket.Put(key, []byte(key), "")
+	}
+
+	releases, err := ListReleases("site", "", bucket, context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(releases, expected) {
+		t.Errorf("expected releases %v, got %v", expected, releases)
+	}
+}
+
+func TestReleaseIDs(t *testing.T) {
+	id := NewReleaseID(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	if id != "20240102T030405Z" {
+		t.Errorf("unexpected release id %s", id)
+	}
+
+	for _, invalid := range []string{"", "current", "a/b", ".hidden"} {
+		if ValidateReleaseID(invalid) == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+
+	if prefix := ReleasePrefix("/docs/", id); !strings.HasPrefix(prefix, "docs/releases/") {
+		t.Errorf("unexpected release prefix %s", prefix)
+	}
+}
+
+func TestPruneReleasesByAge(t *testing.T) {
+	bucket := fakeaws.NewBucket("site")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "SITE", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com"}}},
+	)
+
+	// git SHAs do not sort by time, c0ffee is the oldest release and 1abc the newest
+	ids := []string{"c0ffee", "beef", "1abc"}
+
+	for i, id := range ids {
+		dir := writeSite(t, map[string]string{"index.html": "home " + id})
+		runRoot(t, bucket, distributions, "--directory", dir, "--release", "--release-id", id, "--keep-releases", "2")
+
+		bucket.SetLastModified("releases/"+id+"/index.html", time.Now().Add(time.Duration(i-len(ids))*time.Hour))
+	}
+
+	expected := []string{"releases/1abc/index.html", "releases/beef/index.html", "releases/current"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected the oldest release to be pruned, got %v", keys)
+	}
+}
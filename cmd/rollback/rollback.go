@@ -0,0 +1,58 @@
+package rollback
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd"
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [release-id]",
+	Short: "Switch traffic back to an earlier release",
+	Long: `Points traffic at a release that was deployed with --release and is still stored
+under <prefix>/releases/, the same way a deploy switches to a new release.
+
+Example Usage:
+	go run . rollback --bucket s3-bucket-name --list
+	go run . rollback --bucket s3-bucket-name 20240101T120000Z
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(command *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		list, _ := command.Flags().GetBool("list")
+
+		if !list && len(args) == 0 {
+			return errors.New("release id is required, use --list to see the stored releases")
+		}
+
+		config, err := cmd.NewConfig(command, args)
+
+		if err != nil {
+			return err
+		}
+
+		id := ""
+
+		if len(args) > 0 {
+			id = args[0]
+		}
+
+		return cmd.Rollback(config, id, list, ctx)
+	},
+}
+
+func init() {
+	cmd.AddBucketFlags(rollbackCmd)
+	rollbackCmd.Flags().String("distribution-id", "", "CloudFront distribution to switch, looked up from the bucket if not set")
+	rollbackCmd.Flags().String("switch", cmd.SwitchOrigin, "How to switch to the release: origin or pointer")
+	rollbackCmd.Flags().Bool("wait-invalidation", false, "Wait for the CloudFront invalidation to complete")
+	rollbackCmd.Flags().Bool("list", false, "List the stored releases instead of switching")
+
+	cmd.RootCmd.AddCommand(rollbackCmd)
+}
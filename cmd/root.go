@@ -4,16 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/spf13/cobra"
 )
 
 type Config struct {
+	ConfigName      string
 	Region          string
 	AccessKeyID     string
 	SecretAccessKey string
@@ -23,18 +23,43 @@ type Config struct {
 	Prefix          string
 	Directory       string
 	CfInvalidate    bool
+	DistributionID  string
+	Headers         []HeaderRule
+	Keys            KeyStrategy
+	Ignore          *IgnoreRules
+	Exclude         []string
+	Include         []string
+	Preserve        []string
+	Compression     CompressOptions
+	Multipart       MultipartOptions
+	Concurrency     int
+	Limits          DeleteLimits
+	Release         ReleaseOptions
+	FromManifest    bool
+	ManifestDetails bool
+	DryRun          bool
+	KeepGoing       bool
+
+	InvalidationThreshold int
+	WaitInvalidation      bool
 }
 
 type SavedConfig struct {
-	UserDirectory   string `json:"userDirectory"`
-	Name            string `json:"name"`
-	Region          string `json:"region"`
-	AccessKeyID     string `json:"accessKeyId"`
-	SecretAccessKey string `json:"secretAccessKey"`
-	Profile         string `json:"profile"`
-	Role            string `json:"role"`
-	Bucket          string `json:"bucket"`
-	Directory       string `json:"directory"`
+	UserDirectory   string       `json:"userDirectory"`
+	Name            string       `json:"name"`
+	Region          string       `json:"region"`
+	AccessKeyID     string       `json:"accessKeyId,omitempty"`
+	SecretAccessKey string       `json:"secretAccessKey,omitempty"`
+	SecretRef       string       `json:"secretRef,omitempty"`
+	Profile         string       `json:"profile"`
+	Role            string       `json:"role"`
+	Bucket          string       `json:"bucket"`
+	Directory       string       `json:"directory"`
+	DistributionID  string       `json:"distributionId,omitempty"`
+	Headers         []HeaderRule `json:"headers,omitempty"`
+	HTMLKeys        string       `json:"htmlKeys,omitempty"`
+	HTMLExempt      []string     `json:"htmlExempt,omitempty"`
+	Preserve        []string     `json:"preserve,omitempty"`
 }
 
 type SavedConfigFile struct {
@@ -58,7 +83,11 @@ func LoadConfigFromFile(configName string) (*Config, error) {
 	}
 
 	if foundProfile == nil {
-		return nil, fmt.Errorf("config with name %s not found", configName)
+		return nil, fmt.Errorf("%w: no config with name %s", ErrConfigNotFound, configName)
+	}
+
+	if err = ResolveSecrets(foundProfile); err != nil {
+		return nil, err
 	}
 
 	return &Config{
@@ -69,6 +98,10 @@ func LoadConfigFromFile(configName string) (*Config, error) {
 		Role:            foundProfile.Role,
 		Bucket:          foundProfile.Bucket,
 		Directory:       foundProfile.Directory,
+		DistributionID:  foundProfile.DistributionID,
+		Headers:         foundProfile.Headers,
+		Keys:            KeyStrategy{Mode: foundProfile.HTMLKeys, Exempt: foundProfile.HTMLExempt},
+		Preserve:        foundProfile.Preserve,
 	}, nil
 }
 
@@ -76,10 +109,22 @@ func NewConfig(cmd *cobra.Command, args []string) (*Config, error) {
 	configName, loadFromConfigErr := cmd.Flags().GetString("config")
 
 	if loadFromConfigErr == nil && configName != "" {
-		config, err := LoadConfigFromFile(configName)
+		config, err := LoadConfig(configName)
 
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+
+		config.ConfigName = configName
+
+		if config.Region == "" {
+			config.Region, _ = cmd.Flags().GetString("region")
+		}
+
+		applyCredentialFlags(cmd, config)
+
+		if err = applyRunFlags(cmd, config); err != nil {
+			return nil, err
 		}
 
 		return config, nil
@@ -102,8 +147,9 @@ func NewConfig(cmd *cobra.Command, args []string) (*Config, error) {
 	role, _ := cmd.Flags().GetString("role")
 
 	cfInvalidate, _ := cmd.Flags().GetBool("cf-invalidate")
+	distributionID, _ := cmd.Flags().GetString("distribution-id")
 
-	return &Config{
+	config := &Config{
 		Region:          region,
 		AccessKeyID:     accessKeyId,
 		SecretAccessKey: secretAccesKey,
@@ -113,122 +159,449 @@ func NewConfig(cmd *cobra.Command, args []string) (*Config, error) {
 		Directory:       directory,
 		Prefix:          prefix,
 		CfInvalidate:    cfInvalidate,
-	}, nil
+		DistributionID:  distributionID,
+	}
+
+	if err := applyRunFlags(cmd, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// applyCredentialFlags lets credentials passed on the command line replace the ones of a
+// project environment or saved profile. Project files can't hold access keys, so without
+// this an environment without a profile could only use the environment variables.
+func applyCredentialFlags(cmd *cobra.Command, config *Config) {
+	accessKeyId, _ := cmd.Flags().GetString("access-key-id")
+	secretAccessKey, _ := cmd.Flags().GetString("secret-access-key")
+
+	if accessKeyId != "" && secretAccessKey != "" {
+		config.AccessKeyID = accessKeyId
+		config.SecretAccessKey = secretAccessKey
+		config.Profile = ""
+	}
+
+	if cmd.Flags().Changed("profile") {
+		config.Profile, _ = cmd.Flags().GetString("profile")
+		config.AccessKeyID = ""
+		config.SecretAccessKey = ""
+	}
+
+	if cmd.Flags().Changed("role") {
+		config.Role, _ = cmd.Flags().GetString("role")
+	}
+}
+
+// applyRunFlags reads the flags that only affect a single run, so they apply
+// whether or not the rest of the config was loaded from a saved profile.
+// Header rules given on the command line are added after any saved ones.
+func applyRunFlags(cmd *cobra.Command, config *Config) error {
+	config.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+	config.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	config.KeepGoing, _ = cmd.Flags().GetBool("keep-going")
+	config.InvalidationThreshold, _ = cmd.Flags().GetInt("invalidation-threshold")
+	config.WaitInvalidation, _ = cmd.Flags().GetBool("wait-invalidation")
+	config.Limits.MaxDeletes, _ = cmd.Flags().GetInt("max-deletes")
+	config.Limits.MaxPercent, _ = cmd.Flags().GetFloat64("max-delete-percent")
+	config.Limits.Force, _ = cmd.Flags().GetBool("force")
+	config.FromManifest, _ = cmd.Flags().GetBool("from-manifest")
+	config.ManifestDetails, _ = cmd.Flags().GetBool("manifest-details")
+	config.Release.Enabled, _ = cmd.Flags().GetBool("release")
+	config.Release.ID, _ = cmd.Flags().GetString("release-id")
+	config.Release.Switch, _ = cmd.Flags().GetString("switch")
+	config.Release.Keep, _ = cmd.Flags().GetInt("keep-releases")
+
+	if config.Release.Enabled {
+		if config.Directory == "" {
+			return errors.New("--release needs a --directory to deploy")
+		}
+
+		if config.Release.ID == "" {
+			config.Release.ID = NewReleaseID(time.Now())
+		}
+
+		if err := ValidateReleaseID(config.Release.ID); err != nil {
+			return err
+		}
+	}
+
+	if config.Release.Switch != "" {
+		if err := ValidateSwitch(config.Release.Switch); err != nil {
+			return err
+		}
+	}
+
+	if distributionID, _ := cmd.Flags().GetString("distribution-id"); distributionID != "" {
+		config.DistributionID = distributionID
+	}
+
+	if cfInvalidate, _ := cmd.Flags().GetBool("cf-invalidate"); cfInvalidate {
+		config.CfInvalidate = true
+	}
+
+	// saved profiles only keep the strategy if one was chosen
+	if cmd.Flags().Changed("html-keys") || config.Keys.Mode == "" {
+		config.Keys.Mode, _ = cmd.Flags().GetString("html-keys")
+	}
+
+	if cmd.Flags().Changed("html-exempt") || config.Keys.Exempt == nil {
+		config.Keys.Exempt, _ = cmd.Flags().GetStringSlice("html-exempt")
+	}
+
+	if err := ValidateKeyStrategy(config.Keys.Mode); err != nil {
+		return err
+	}
+
+	excludes, _ := cmd.Flags().GetStringArray("exclude")
+	includes, _ := cmd.Flags().GetStringArray("include")
+	ignore, err := LoadIgnoreRules(config.Directory, append(config.Exclude, excludes...), append(config.Include, includes...))
+
+	if err != nil {
+		return err
+	}
+
+	config.Ignore = ignore
+
+	preserve, _ := cmd.Flags().GetStringArray("preserve")
+	config.Preserve = append(config.Preserve, preserve...)
+
+	// project environments may choose a compression, flags given on the command line win
+	if cmd.Flags().Changed("compress") || config.Compression.Encoding == "" {
+		config.Compression.Encoding, _ = cmd.Flags().GetString("compress")
+	}
+
+	if cmd.Flags().Changed("compress-types") || config.Compression.Types == nil {
+		config.Compression.Types, _ = cmd.Flags().GetStringSlice("compress-types")
+	}
+
+	if err := ValidateEncoding(config.Compression.Encoding); err != nil {
+		return err
+	}
+
+	multipartThreshold, _ := cmd.Flags().GetInt64("multipart-threshold")
+	partSize, _ := cmd.Flags().GetInt64("part-size")
+	config.Multipart.Threshold = multipartThreshold * MiB
+	config.Multipart.PartSize = partSize * MiB
+	config.Multipart.Concurrency, _ = cmd.Flags().GetInt("part-concurrency")
+
+	if config.Multipart.PartSize != 0 && config.Multipart.PartSize < minPartSize {
+		return fmt.Errorf("part size must be at least %d MiB", minPartSize/MiB)
+	}
+
+	headers, _ := cmd.Flags().GetStringArray("header")
+
+	for _, header := range headers {
+		rule, err := ParseHeaderRule(header)
+
+		if err != nil {
+			return err
+		}
+
+		config.Headers = append(config.Headers, rule)
+	}
+
+	return nil
+}
+
+func (config *Config) UploadOptions() UploadOptions {
+	return UploadOptions{
+		Keys:        config.Keys,
+		Ignore:      config.Ignore,
+		Preserve:    config.Preserve,
+		Concurrency: config.Concurrency,
+		Headers:     config.Headers,
+		Compression: config.Compression,
+		Multipart:   config.Multipart,
+		Limits:      config.Limits,
+
+		FromManifest: config.FromManifest,
+	}
 }
 
 var RootCmd = &cobra.Command{
 	Use:   "sync-static-site-s3",
 	Short: "Upload a directory containing files for a static site to a S3 Bucket",
-	Long: `This CLI uploads the files in a directory to an S3 bucket but makes important
+	Long: `This CLI syncs the files in a directory to an S3 bucket but makes important
 considerations for html files. If the file is an html file, the .html extension is removed
 except for index.html and error.html, since we no longer have the html extension we also need
 to set the file's Content-Type. This is necessary to allow the files to be accessed without
 the .html extension, for example, domain.com/file instead of domain.com/file.html.
 
+Use --html-keys to pick another strategy: directory-index uploads about.html as
+about/index.html, both uploads it under both keys and keep leaves the name as is.
+
+Only new and changed files are uploaded (compared by size and MD5 against the object's ETag),
+and objects under the prefix that no longer exist locally are removed once the uploads finish.
+Nothing is changed when more than --max-delete-percent (50% by default) or --max-deletes
+objects would be removed, when the directory has no files or when no directory is given,
+unless --force is passed.
+
+With --release the site is uploaded to <prefix>/releases/<id>/ instead, and only once every
+file is in place is traffic switched to it, by pointing the CloudFront origin at the release
+(--switch origin) or by rewriting the releases/current pointer object (--switch pointer).
+Use the rollback subcommand to switch back to an earlier release.
+
+After every successful sync a manifest of the deployed keys is written to
+<prefix>/.sync-s3/, see the history subcommand. --from-manifest diffs against the latest
+manifest instead of listing the bucket, as long as the first page of the listing agrees with
+it. The manifest is served along with the site, so the git commit and profile name are only
+recorded with --manifest-details.
+
+With --output json every step is printed as a line of JSON, ending with a summary object.
+
+Exit codes:
+	0  success
+	1  any other failure
+	3  config not found
+	4  credentials missing
+	5  bucket access denied
+	6  partial upload, some uploads or removals failed after the bucket was changed
+	7  invalidation failed
+
 Example Usage:
 	go run . --directory /path/to/static/site --bucket s3-bucket-name
 `,
-	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.TODO()
+	// flags were parsed fine, so usage would only hide the actual error
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
 
-		if len(args) > 0 {
-			fmt.Println("Additional supplied args will be ignored")
+		if err := ValidateOutput(output); err != nil {
+			return err
 		}
 
-		userInput, err := NewConfig(cmd, args)
+		reporter = NewReporter(NewRenderer(output))
+
+		// cancel in-flight uploads on Ctrl+C
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		failure, err := run(cmd, args, ctx)
+		err = checkAccess(err)
+		reporter.Finish(failure, err)
 
 		if err != nil {
-			log.Fatal(err)
+			// the renderer has shown the error already
+			return &ExitError{Code: ExitCode(err), Err: err}
 		}
 
-		_, awsConfig, err := GetAWSConfig(
-			userInput.AccessKeyID,
-			userInput.SecretAccessKey,
-			userInput.Profile,
-			userInput.Region,
-			userInput.Role,
-			ctx,
-		)
+		return nil
+	},
+	SilenceErrors: true,
+}
+
+// run deploys the directory, reporting every step as an event. If it fails it also
+// returns a message saying which step failed, or "" when the error says so itself.
+func run(cmd *cobra.Command, args []string, ctx context.Context) (string, error) {
+	if len(args) > 0 {
+		message("Additional supplied args will be ignored")
+	}
+
+	userInput, err := NewConfig(cmd, args)
+
+	if err != nil {
+		return "", err
+	}
+
+	awsConfig, err := connect(userInput, ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	client := newS3Client(awsConfig)
+
+	if userInput.DryRun {
+		plan, err := PlanDeploy(userInput, client, newCloudFrontClient(awsConfig), ctx)
 
 		if err != nil {
-			log.Fatal(err)
+			return "Failed to compute deploy plan", err
 		}
 
-		client := s3.NewFromConfig(awsConfig)
+		event := plan.Event()
 
-		err = EmptyBucket(userInput.Bucket, userInput.Prefix, client, ctx)
+		if err := userInput.Limits.CheckDirectory(userInput.Directory); err != nil {
+			event.Warning = err.Error()
+		} else if err := userInput.Limits.Check(plan.Sync); err != nil {
+			event.Warning = err.Error()
+		}
 
-		if err != nil {
-			fmt.Println("Failed to clear bucket, aborting upload")
-			log.Fatal(err)
+		emit(event)
+
+		return "", nil
+	}
+
+	// nothing has been changed yet, so a refused run leaves the bucket as it is
+	if err := userInput.Limits.CheckDirectory(userInput.Directory); err != nil {
+		return "", err
+	}
+
+	if userInput.Release.Enabled {
+		if err = DeployRelease(userInput, client, newCloudFrontClient(awsConfig), ctx); err != nil {
+			return "Failed to deploy release", err
 		}
 
-		if userInput.Directory == "" {
-			return
+		return "", nil
+	}
+
+	if userInput.Directory == "" {
+		// a later --from-manifest sync would otherwise trust the manifest of the removed files
+		if err = RemoveLatestManifest(userInput.Bucket, userInput.Prefix, client, ctx); err != nil {
+			return "Failed to clear bucket", err
 		}
 
-		// TODO: can i batch this?
-		err = UploadDirectory(
-			userInput.Directory,
-			userInput.Bucket,
-			userInput.Prefix,
-			client,
-			ctx,
-		)
+		err = EmptyBucket(userInput.Bucket, userInput.Prefix, userInput.UploadOptions().protectRules(), client, ctx)
+
 		if err != nil {
-			log.Fatal(err)
+			return "Failed to clear bucket", err
 		}
 
-		if !userInput.CfInvalidate {
-			return
-		}
+		return "", nil
+	}
 
-		fmt.Println("Creating CloudFront invalidation...")
+	plan, syncErr := SyncDirectory(
+		userInput.Directory,
+		userInput.Bucket,
+		userInput.Prefix,
+		userInput.UploadOptions(),
+		client,
+		ctx,
+	)
+	if syncErr != nil {
+		if plan == nil || !userInput.KeepGoing {
+			return "", syncErr
+		}
 
-		cloudFrontClient := cloudfront.NewFromConfig(awsConfig)
+		message("Sync failed, continuing since --keep-going is set: %s", syncErr)
+	}
 
-		_, err = InvalidateCache(userInput.Bucket, cloudFrontClient, ctx)
+	if userInput.CfInvalidate {
+		err = invalidateChanges(userInput, plan.Applied, newCloudFrontClient(awsConfig), ctx)
 
 		if err != nil {
-			log.Fatal(err)
+			return "", fmt.Errorf("%w: %w", ErrInvalidationFailed, err)
 		}
-	},
+	}
+
+	// only a complete sync is recorded, the manifest has to match the bucket
+	if syncErr == nil {
+		manifest := NewManifest(userInput, userInput.Prefix, plan, time.Now())
+
+		if err = WriteManifest(manifest, userInput.Prefix, client, ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return "", syncErr
 }
 
-func UploadDirectory(directory, bucket, prefix string, client *s3.Client, ctx context.Context) error {
-	return filepath.Walk(
-		directory,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+func invalidateChanges(userInput *Config, changedKeys []string, cloudFrontClient CloudFrontAPI, ctx context.Context) error {
+	if len(changedKeys) == 0 {
+		message("Nothing changed, skipping CloudFront invalidation")
+		return nil
+	}
 
-			if info.IsDir() {
-				return nil
-			}
+	message("Creating CloudFront invalidation...")
 
-			return UploadFile(directory, path, bucket, prefix, client, ctx)
-		},
-	)
+	distributionID, originPath, err := ResolveDistributionID(userInput, cloudFrontClient, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	paths := DistributionPaths(changedKeys, userInput.Prefix, originPath, userInput.InvalidationThreshold)
+
+	if len(paths) == 0 {
+		message("No changed file is served by distribution %s, skipping CloudFront invalidation", distributionID)
+		return nil
+	}
+
+	invalidation, err := CreateInvalidation(distributionID, paths, cloudFrontClient, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	emit(&InvalidationEvent{
+		DistributionID: distributionID,
+		InvalidationID: aws.ToString(invalidation.Invalidation.Id),
+		Paths:          paths,
+		Status:         InvalidationCreated,
+	})
+
+	if !userInput.WaitInvalidation {
+		return nil
+	}
+
+	message("Waiting for invalidation to complete...")
+
+	return WaitForInvalidation(distributionID, invalidation, cloudFrontClient, ctx)
 }
 
+// Execute runs the command line and exits with the status ExitCode maps its error to.
 func Execute() {
 	err := RootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+
+	if err == nil {
+		return
+	}
+
+	var exitErr *ExitError
+
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 	}
+
+	os.Exit(ExitCode(err))
+}
+
+// AddBucketFlags registers the flags NewConfig reads to pick the saved config or project
+// environment, the bucket and prefix, and the credentials to use.
+func AddBucketFlags(command *cobra.Command) {
+	flags := command.Flags()
+	flags.StringP("config", "c", "", "Environment of the project file or saved config profile to use. See config subcommand to list options.")
+	flags.StringP("bucket", "b", "", "S3 bucket name")
+	flags.StringP("prefix", "x", "", "S3 bucket path prefix")
+	flags.StringP("region", "r", "us-east-1", "S3 bucket region")
+	flags.String("access-key-id", "", "AWS Access Key ID")
+	flags.String("secret-access-key", "", "AWS Secret Access Key")
+	flags.StringP("profile", "p", "", "AWS Profile name")
+	flags.StringP("role", "", "", "Role to switch into")
 }
 
 func init() {
-	RootCmd.Flags().StringP("config", "c", "", "Config Profile to use. See config subcommand to list options.")
+	AddBucketFlags(RootCmd)
 	RootCmd.Flags().StringP("directory", "d", "", "Path to the static site directory")
 	_ = RootCmd.MarkFlagDirname("directory")
-	RootCmd.Flags().StringP("bucket", "b", "", "S3 bucket name")
-	RootCmd.Flags().StringP("prefix", "x", "", "S3 bucket path prefix")
-	RootCmd.Flags().StringP("region", "r", "us-east-1", "S3 bucket region")
-	RootCmd.Flags().String("access-key-id", "", "AWS Access Key ID")
-	RootCmd.Flags().String("secret-access-key", "", "AWS Secret Access Key")
-	RootCmd.Flags().StringP("profile", "p", "", "AWS Profile name")
-	RootCmd.Flags().StringP("role", "", "", "Role to switch into")
 	RootCmd.Flags().BoolP("cf-invalidate", "", false, "Wether to create a CloudFront invalidation")
+	RootCmd.Flags().StringArray("header", nil, "Header rule <glob>:<header>=<value>, e.g. '*.html:Cache-Control=no-cache' (repeatable)")
+	RootCmd.Flags().StringArray("exclude", nil, "Skip files matching this gitignore style glob, also keeps matching remote keys (repeatable)")
+	RootCmd.Flags().StringArray("include", nil, "Upload files matching this glob even if they are excluded (repeatable)")
+	RootCmd.Flags().StringArray("preserve", nil, "Never remove remote keys matching this glob, relative to the prefix (repeatable)")
+	RootCmd.Flags().String("html-keys", HTMLStripExtension, "How html files map to keys: strip-extension, directory-index, both or keep")
+	RootCmd.Flags().StringSlice("html-exempt", DefaultHTMLExempt, "html file names that keep their name at any depth")
+	RootCmd.Flags().String("compress", "", "Compress matching files before upload, gzip or br")
+	RootCmd.Flags().StringSlice("compress-types", DefaultCompressTypes, "MIME types or extensions (like .wasm) to compress")
+	RootCmd.Flags().Int64("multipart-threshold", DefaultMultipartThreshold/MiB, "Upload files of at least this many MiB in parts")
+	RootCmd.Flags().Int64("part-size", DefaultPartSize/MiB, "Size of each part in MiB for multipart uploads")
+	RootCmd.Flags().Int("part-concurrency", DefaultPartConcurrency, "Number of parts of a file to upload at the same time")
+	RootCmd.Flags().String("distribution-id", "", "CloudFront distribution to invalidate, looked up from the bucket if not set")
+	RootCmd.Flags().Int("invalidation-threshold", DefaultInvalidationThreshold, "Collapse invalidated paths into wildcards above this many paths")
+	RootCmd.Flags().Bool("wait-invalidation", false, "Wait for the CloudFront invalidation to complete")
+	RootCmd.Flags().Int("concurrency", DefaultConcurrency, "Number of files to upload at the same time")
+	RootCmd.Flags().Bool("from-manifest", false, "Diff against the manifest of the last deploy instead of listing the bucket")
+	RootCmd.Flags().Bool("manifest-details", false, "Record the git commit and profile name in the manifest, which is served with the site")
+	RootCmd.Flags().Bool("release", false, "Upload to <prefix>/releases/<id>/ and switch traffic once every file is uploaded")
+	RootCmd.Flags().String("release-id", "", "ID of the release, defaults to the current UTC time")
+	RootCmd.Flags().String("switch", SwitchOrigin, "How to switch to a release: origin updates the CloudFront origin path, pointer only rewrites releases/current")
+	RootCmd.Flags().Int("keep-releases", DefaultKeepReleases, "Number of releases to keep, 0 keeps every release")
+	RootCmd.Flags().Int("max-deletes", 0, "Refuse to run when more than this many objects would be removed, 0 for no limit")
+	RootCmd.Flags().Float64("max-delete-percent", DefaultMaxDeletePercent, "Refuse to run when more than this percent of the objects under the prefix would be removed, 0 for no limit")
+	RootCmd.Flags().Bool("force", false, "Remove objects even if the deletion limits are exceeded or the directory is empty")
+	RootCmd.Flags().Bool("keep-going", false, "Invalidate whatever changed even if uploads or removals failed, then exit with an error")
+	RootCmd.Flags().Bool("dry-run", false, "Print the deploy plan without changing the bucket or distribution")
+	RootCmd.Flags().String("output", OutputText, "Output format, text or json for newline-delimited JSON events")
 }
@@ -0,0 +1,433 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/pflag"
+)
+
+// runRoot executes the root command against the given fakes with fresh flag values.
+func runRoot(t *testing.T, bucket *fakeaws.Bucket, distributions *fakeaws.Distributions, args ...string) {
+	t.Helper()
+
+	if err := executeRoot(bucket, distributions, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// executeRoot is runRoot for runs that are expected to fail.
+func executeRoot(bucket *fakeaws.Bucket, distributions *fakeaws.Distributions, args ...string) error {
+	newS3Client = func(aws.Config) S3API { return bucket }
+	newCloudFrontClient = func(aws.Config) CloudFrontAPI { return distributions }
+
+	RootCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			var values []string
+
+			if defaults := strings.Trim(flag.DefValue, "[]"); defaults != "" {
+				values = strings.Split(defaults, ",")
+			}
+
+			_ = slice.Replace(values)
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	})
+
+	RootCmd.SetArgs(append([]string{"--access-key-id", "id", "--secret-access-key", "secret", "--bucket", bucket.Name}, args...))
+
+	return RootCmd.Execute()
+}
+
+// siteKeys returns the keys of the bucket without the deploy manifests.
+func siteKeys(bucket *fakeaws.Bucket) []string {
+	keys := []string{}
+
+	for _, key := range bucket.Keys() {
+		if !strings.HasPrefix(key, ReservedDirectory) && !strings.Contains(key, "/"+ReservedDirectory) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func writeSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestRootSync(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html":     "<h1>home</h1>",
+		"about.html":     "<h1>about</h1>",
+		"css/styles.css": "body {}",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.PageSize = 1
+	bucket.Put("index.html", []byte("<h1>home</h1>"), "text/html; charset=utf-8")
+	bucket.Put("about", []byte("<h1>old about</h1>"), "text/html; charset=utf-8")
+	bucket.Put("removed", []byte("gone"), "text/html; charset=utf-8")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+
+	expected := []string{"about", "css/styles.css", "index.html"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	if obj := bucket.Get("about"); string(obj.Body) != "<h1>about</h1>" || obj.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("about was not updated: %q (%s)", obj.Body, obj.ContentType)
+	}
+
+	// index.html was unchanged, so 2 uploads plus the manifest and its history entry
+	if puts := bucket.PutCount(); puts != 4 {
+		t.Errorf("expected 4 puts, got %d", puts)
+	}
+}
+
+func TestRootHeaderRules(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html":    "home",
+		"assets/app.js": "app",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir,
+		"--header", "*.html:Cache-Control=no-cache",
+		"--header", "assets/*:Cache-Control=public, max-age=31536000, immutable",
+	)
+
+	if cacheControl := bucket.Get("index.html").CacheControl; cacheControl != "no-cache" {
+		t.Errorf("expected index.html to be no-cache, got %q", cacheControl)
+	}
+
+	if cacheControl := bucket.Get("assets/app.js").CacheControl; cacheControl != "public, max-age=31536000, immutable" {
+		t.Errorf("expected assets/app.js to be immutable, got %q", cacheControl)
+	}
+}
+
+func TestRootHeaderRuleChange(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html":    "home",
+		"assets/app.js": "app",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir)
+
+	puts := bucket.PutCount()
+
+	// only the header rule changed, the content of both files is the same
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir,
+		"--header", "assets/*:Cache-Control=public, max-age=31536000, immutable",
+	)
+
+	if cacheControl := bucket.Get("assets/app.js").CacheControl; cacheControl != "public, max-age=31536000, immutable" {
+		t.Errorf("expected assets/app.js to be re-uploaded as immutable, got %q", cacheControl)
+	}
+
+	// every run also writes the manifest and the latest manifest
+	if uploads := bucket.PutCount() - puts; uploads != 3 {
+		t.Errorf("expected only assets/app.js and the manifests to be uploaded, got %d puts", uploads)
+	}
+}
+
+func TestRootCompression(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html": "<h1>home</h1>",
+		"logo.png":   "png",
+		"app.js":     "console.log(1)",
+		"app.js.gz":  "bundler output",
+		"styles.css": "body {}",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--compress", "gzip")
+
+	index := bucket.Get("index.html")
+	reader, err := gzip.NewReader(bytes.NewReader(index.Body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := io.ReadAll(reader); string(body) != "<h1>home</h1>" || index.ContentEncoding != "gzip" || index.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("index.html was not compressed: %q (%s, %s)", body, index.ContentEncoding, index.ContentType)
+	}
+
+	if app := bucket.Get("app.js"); string(app.Body) != "bundler output" || app.ContentEncoding != "gzip" {
+		t.Errorf("expected app.js to be uploaded from app.js.gz, got %q (%s)", app.Body, app.ContentEncoding)
+	}
+
+	if bucket.Get("app.js.gz") != nil {
+		t.Errorf("app.js.gz should not be uploaded under its own key")
+	}
+
+	if logo := bucket.Get("logo.png"); logo.ContentEncoding != "" {
+		t.Errorf("logo.png should not be compressed")
+	}
+
+	// compressed output is stable, so only the manifest and its history entry are written again
+	puts := bucket.PutCount()
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--compress", "gzip")
+
+	if bucket.PutCount() != puts+2 {
+		t.Errorf("expected no uploads on the second run, got %d", bucket.PutCount()-puts-2)
+	}
+}
+
+func TestRootHTMLKeys(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"index.html":      "home",
+		"about.html":      "about",
+		"blog/index.html": "blog",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--html-keys", "both")
+
+	expected := []string{"about", "about/index.html", "blog/index.html", "index.html"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestRootIgnore(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		".syncignore":   "*.map\n",
+		".DS_Store":     "junk",
+		"index.html":    "home",
+		"app.js":        "app",
+		"app.js.map":    "map",
+		".git/HEAD":     "ref",
+		"drafts/a.html": "draft",
+	})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("docs/robots.txt", []byte("User-agent: *"), "text/plain; charset=utf-8")
+	bucket.Put("docs/old.js.map", []byte("old map"), "application/json")
+	bucket.Put("docs/old", []byte("old"), "text/html; charset=utf-8")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--prefix", "docs",
+		"--exclude", ".DS_Store", "--exclude", ".git", "--exclude", "robots.txt", "--exclude", "drafts",
+	)
+
+	expected := []string{"docs/app.js", "docs/index.html", "docs/old.js.map", "docs/robots.txt"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestRootPreserve(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put(".well-known/acme-challenge/token", []byte("token"), "")
+	bucket.Put("media/2024/photo.jpg", []byte("jpg"), "image/jpeg")
+	bucket.Put("old", []byte("old"), "text/html; charset=utf-8")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--preserve", ".well-known/**", "--preserve", "/media")
+
+	expected := []string{".well-known/acme-challenge/token", "index.html", "media/2024/photo.jpg"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	// no directory clears the bucket, but still keeps preserved keys
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--force", "--preserve", ".well-known/**", "--preserve", "/media")
+
+	expected = []string{".well-known/acme-challenge/token", "media/2024/photo.jpg"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestRootSyncPrefix(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("docs/index.html", []byte("old home"), "text/html; charset=utf-8")
+	bucket.Put("docs/old", []byte("old"), "text/html; charset=utf-8")
+	bucket.Put("docs2/index.html", []byte("other site"), "text/html; charset=utf-8")
+
+	runRoot(t, bucket, fakeaws.NewDistributions(), "--directory", dir, "--prefix", "docs")
+
+	expected := []string{"docs/index.html", "docs2/index.html"}
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestRootInvalidation(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+
+	bucket := fakeaws.NewBucket("site")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "OTHER", Origins: []fakeaws.Origin{{DomainName: "other.s3.us-east-1.amazonaws.com"}}},
+		fakeaws.Distribution{ID: "SITE", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com"}}},
+	)
+
+	runRoot(t, bucket, distributions, "--directory", dir, "--cf-invalidate", "--wait-invalidation")
+
+	invalidations := distributions.Invalidations()
+
+	if len(invalidations) != 1 || invalidations[0].DistributionID != "SITE" {
+		t.Fatalf("expected one invalidation of SITE, got %v", invalidations)
+	}
+
+	if expected := []string{"/", "/index.html"}; !reflect.DeepEqual(invalidations[0].Paths, expected) {
+		t.Errorf("expected %v to be invalidated, got %v", expected, invalidations[0].Paths)
+	}
+
+	// nothing changed on the second run
+	runRoot(t, bucket, distributions, "--directory", dir, "--cf-invalidate")
+
+	if len(distributions.Invalidations()) != 1 {
+		t.Errorf("expected no invalidation when nothing changed")
+	}
+}
+
+func TestRootInvalidationOriginPath(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home", "about.html": "about"})
+
+	bucket := fakeaws.NewBucket("site")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "DOCS", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com", OriginPath: "/docs"}}},
+	)
+
+	runRoot(t, bucket, distributions, "--directory", dir, "--prefix", "docs", "--cf-invalidate")
+
+	invalidations := distributions.Invalidations()
+
+	if len(invalidations) != 1 || invalidations[0].DistributionID != "DOCS" {
+		t.Fatalf("expected one invalidation of DOCS, got %v", invalidations)
+	}
+
+	// DOCS serves docs/about at /about
+	if expected := []string{"/", "/about", "/index.html"}; !reflect.DeepEqual(invalidations[0].Paths, expected) {
+		t.Errorf("expected %v to be invalidated, got %v", expected, invalidations[0].Paths)
+	}
+}
+
+func TestRootInvalidationDistributionID(t *testing.T) {
+	captureOutput(t)
+
+	dir := writeSite(t, map[string]string{"index.html": "home", "about.html": "about"})
+
+	bucket := fakeaws.NewBucket("site")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "DOCS", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com", OriginPath: "/docs"}}},
+	)
+
+	runRoot(t, bucket, distributions, "--directory", dir, "--prefix", "docs", "--distribution-id", "DOCS", "--cf-invalidate")
+
+	invalidations := distributions.Invalidations()
+
+	if len(invalidations) != 1 {
+		t.Fatalf("expected one invalidation, got %v", invalidations)
+	}
+
+	// same as discovering DOCS, its origin path is stripped
+	if expected := []string{"/", "/about", "/index.html"}; !reflect.DeepEqual(invalidations[0].Paths, expected) {
+		t.Errorf("expected %v to be invalidated, got %v", expected, invalidations[0].Paths)
+	}
+
+	// DOCS serves none of the keys under other, so nothing is invalidated rather than /*
+	runRoot(t, bucket, distributions, "--directory", dir, "--prefix", "other", "--distribution-id", "DOCS", "--cf-invalidate")
+
+	if invalidations = distributions.Invalidations(); len(invalidations) != 1 {
+		t.Errorf("expected no invalidation for keys DOCS does not serve, got %v", invalidations)
+	}
+}
+
+func TestRootKeepGoing(t *testing.T) {
+	captureOutput(t)
+
+	dir := writeSite(t, map[string]string{"index.html": "home", "about.html": "about", "broken.html": "broken"})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("old.html", []byte("old"), "text/html; charset=utf-8")
+	bucket.FailPuts("broken")
+
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "SITE", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com"}}},
+	)
+
+	err := executeRoot(bucket, distributions, "--directory", dir, "--cf-invalidate", "--keep-going", "--force")
+
+	if code := ExitCode(err); code != ExitPartialUpload {
+		t.Fatalf("expected exit code %d, got %d (%v)", ExitPartialUpload, code, err)
+	}
+
+	if bucket.Get("old.html") == nil {
+		t.Errorf("expected old.html to be kept since an upload failed")
+	}
+
+	invalidations := distributions.Invalidations()
+
+	if len(invalidations) != 1 {
+		t.Fatalf("expected the invalidation to run despite the failure, got %v", invalidations)
+	}
+
+	// neither the failed upload nor the skipped removal is invalidated
+	if expected := []string{"/", "/about", "/index.html"}; !reflect.DeepEqual(invalidations[0].Paths, expected) {
+		t.Errorf("expected %v to be invalidated, got %v", expected, invalidations[0].Paths)
+	}
+}
+
+func TestRootDryRun(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "home"})
+
+	bucket := fakeaws.NewBucket("site")
+	bucket.Put("removed", []byte("gone"), "text/html; charset=utf-8")
+	distributions := fakeaws.NewDistributions(
+		fakeaws.Distribution{ID: "SITE", Origins: []fakeaws.Origin{{DomainName: "site.s3.us-east-1.amazonaws.com"}}},
+	)
+
+	runRoot(t, bucket, distributions, "--directory", dir, "--cf-invalidate", "--dry-run")
+
+	if keys := siteKeys(bucket); !reflect.DeepEqual(keys, []string{"removed"}) {
+		t.Errorf("dry run changed the bucket: %v", keys)
+	}
+
+	if len(distributions.Invalidations()) != 0 {
+		t.Errorf("dry run created an invalidation")
+	}
+}
@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConfigFilePath is the file profiles are saved in, swapped out in tests.
+var ConfigFilePath = func() (string, error) {
+	usr, err := user.Current()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, "sync-s3", "config.json"), nil
+}
+
+var (
+	// lockTimeout is how long Update waits for another process to release the lock.
+	lockTimeout = 10 * time.Second
+	// lockStale is the age after which a lock file is assumed to be left by a killed process.
+	// The holder touches the file every third of it.
+	lockStale = 30 * time.Second
+	lockRetry = 50 * time.Millisecond
+)
+
+// heldLocks are the lock files this process holds. The secrets file shares the lock of the
+// config file next to it, and is written both inside Update and on its own.
+var heldLocks sync.Map
+
+// ProfileStore loads and saves the profiles of every directory in one file. Changes go through
+// Update, which holds a lock from load to save so two terminals can't drop each other's profiles.
+type ProfileStore struct {
+	Path string
+}
+
+func NewProfileStore() (*ProfileStore, error) {
+	path, err := ConfigFilePath()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProfileStore{Path: path}, nil
+}
+
+// Load reads every saved profile, for all directories. A missing file has no profiles.
+func (store *ProfileStore) Load() (*SavedConfigFile, error) {
+	data, err := os.ReadFile(store.Path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return &SavedConfigFile{Profiles: []SavedConfig{}}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	file := &SavedConfigFile{}
+
+	if err = json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", store.Path, err)
+	}
+
+	return file, nil
+}
+
+// Save replaces the saved profiles. Use Update to change profiles safely.
+func (store *ProfileStore) Save(file *SavedConfigFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.Path, data)
+}
+
+// writeFileAtomic writes data next to path and renames it over path, so a failed write never
+// leaves a truncated file behind. The file is only readable by the user since it may hold
+// access keys.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+
+	if err != nil {
+		return err
+	}
+
+	// a no-op once the rename succeeded
+	defer os.Remove(temp.Name())
+
+	if err = temp.Chmod(0600); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err = temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err = temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// Update loads the profiles, lets change modify them and saves the result, all while holding
+// the lock. Nothing is written when loading or change fails, so a corrupt file is left alone.
+func (store *ProfileStore) Update(change func(file *SavedConfigFile) error) error {
+	unlock, err := store.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	file, err := store.Load()
+
+	if err != nil {
+		return err
+	}
+
+	if err = change(file); err != nil {
+		return err
+	}
+
+	return store.Save(file)
+}
+
+// Add saves a new profile, keeping every profile already in the file. Its access keys are
+// moved into secrets, unless that is nil.
+func (store *ProfileStore) Add(profile SavedConfig, secrets SecretBackend) error {
+	if secrets != nil && (profile.AccessKeyID != "" || profile.SecretAccessKey != "") {
+		if err := UnlockSecrets(secrets); err != nil {
+			return err
+		}
+	}
+
+	return store.Update(func(file *SavedConfigFile) error {
+		if file.Find(profile.Name, profile.UserDirectory) >= 0 {
+			return fmt.Errorf("profile %s already exists", profile.Name)
+		}
+
+		if secrets != nil {
+			if err := StoreSecrets(secrets, &profile); err != nil {
+				return err
+			}
+		}
+
+		file.Profiles = append(file.Profiles, profile)
+
+		return nil
+	})
+}
+
+// lock creates a lock file next to the config file, waiting while another process holds it.
+// A lock file (rather than flock) works the same on every platform the tool is built for.
+func (store *ProfileStore) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(store.Path), 0700); err != nil {
+		return nil, err
+	}
+
+	path := store.Path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		lockFile, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+
+		if err == nil {
+			token, err := writeLockToken(lockFile)
+
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+
+			heldLocks.Store(path, true)
+			stop := keepLockFresh(path)
+
+			return func() {
+				close(stop)
+				heldLocks.Delete(path)
+				releaseLock(path, token)
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			breakStaleLock(path)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("config file is locked by another process, remove %s if none is running", path)
+		}
+
+		time.Sleep(lockRetry)
+	}
+}
+
+// writeLockToken writes the PID and a random nonce into the new lock file, so only the
+// process that created it removes it.
+func writeLockToken(lockFile *os.File) (string, error) {
+	defer lockFile.Close()
+
+	nonce := make([]byte, 8)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	token := fmt.Sprintf("%d %s", os.Getpid(), hex.EncodeToString(nonce))
+
+	if _, err := lockFile.WriteString(token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// keepLockFresh touches the lock file until stop is closed, so a slow change (like a password
+// manager waiting to be unlocked) is never mistaken for a killed process.
+func keepLockFresh(path string) chan struct{} {
+	stop := make(chan struct{})
+	ticker := time.NewTicker(lockStale / 3)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				_ = os.Chtimes(path, now, now)
+			}
+		}
+	}()
+
+	return stop
+}
+
+// releaseLock removes the lock at path if it still holds token. A lock another process took
+// after breaking this one as stale is left alone.
+func releaseLock(path, token string) {
+	if data, err := os.ReadFile(path); err == nil && string(data) == token {
+		os.Remove(path)
+	}
+}
+
+// withLock runs fn holding the lock, or right away when this process already holds it.
+func (store *ProfileStore) withLock(fn func() error) error {
+	if _, held := heldLocks.Load(store.Path + ".lock"); held {
+		return fn()
+	}
+
+	unlock, err := store.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	return fn()
+}
+
+// breakStaleLock moves the stale lock at path out of the way. Renaming is atomic, so when
+// several waiters saw the same stale lock only the first one moves it. A waiter whose stat
+// was outdated may have moved a lock taken in the meantime instead, and puts it back.
+func breakStaleLock(path string) {
+	moved := fmt.Sprintf("%s.stale-%d-%d", path, os.Getpid(), time.Now().UnixNano())
+
+	if err := os.Rename(path, moved); err != nil {
+		return
+	}
+
+	if info, err := os.Stat(moved); err == nil && time.Since(info.ModTime()) <= lockStale {
+		// Link fails instead of replacing a lock created since the rename
+		_ = os.Link(moved, path)
+	}
+
+	os.Remove(moved)
+}
+
+// Find returns the index of the profile saved as name for userDirectory, or -1.
+func (file *SavedConfigFile) Find(name, userDirectory string) int {
+	for i, profile := range file.Profiles {
+		if profile.Name == name && profile.UserDirectory == userDirectory {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Profile returns the index of the profile saved as name for the working directory.
+func (file *SavedConfigFile) Profile(name string) (int, error) {
+	cwd, err := filepath.Abs(".")
+
+	if err != nil {
+		return -1, err
+	}
+
+	i := file.Find(name, cwd)
+
+	if i < 0 {
+		return -1, fmt.Errorf("%w: no config with name %s", ErrConfigNotFound, name)
+	}
+
+	return i, nil
+}
@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useConfigFile points ConfigFilePath at a file in a temporary directory.
+func useConfigFile(t *testing.T) *ProfileStore {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sync-s3", "config.json")
+	original := ConfigFilePath
+	ConfigFilePath = func() (string, error) { return path, nil }
+	t.Cleanup(func() { ConfigFilePath = original })
+
+	store, err := NewProfileStore()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+// writeConfigFile puts raw contents in the store's file.
+func writeConfigFile(t *testing.T, store *ProfileStore, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(store.Path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(store.Path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileStoreLoadMissing(t *testing.T) {
+	store := useConfigFile(t)
+
+	file, err := store.Load()
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(file.Profiles) != 0 {
+		t.Errorf("Profiles = %v, want none", file.Profiles)
+	}
+}
+
+func TestProfileStoreCorruptFile(t *testing.T) {
+	store := useConfigFile(t)
+	writeConfigFile(t, store, "{not json")
+
+	if _, err := store.Load(); err == nil {
+		t.Errorf("Load() of invalid json did not fail")
+	}
+
+	if err := store.Add(SavedConfig{UserDirectory: "/site", Name: "production"}, nil); err == nil {
+		t.Errorf("Add() to a corrupt file did not fail")
+	}
+
+	data, _ := os.ReadFile(store.Path)
+
+	if string(data) != "{not json" {
+		t.Errorf("corrupt file was overwritten with %q", data)
+	}
+
+	if _, err := os.Stat(store.Path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind after a failed update")
+	}
+}
+
+func TestProfileStoreAddKeepsExisting(t *testing.T) {
+	store := useConfigFile(t)
+	writeConfigFile(t, store, `{"profiles": [
+		{"userDirectory": "/other", "name": "production", "bucket": "other"},
+		{"userDirectory": "/site", "name": "staging", "bucket": "staging"}
+	]}`)
+
+	if err := store.Add(SavedConfig{UserDirectory: "/site", Name: "production", Bucket: "site"}, nil); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if err := store.Add(SavedConfig{UserDirectory: "/site", Name: "staging"}, nil); err == nil {
+		t.Errorf("Add() of an existing profile did not fail")
+	}
+
+	file, err := store.Load()
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	expected := []struct{ userDirectory, name, bucket string }{
+		{"/other", "production", "other"},
+		{"/site", "staging", "staging"},
+		{"/site", "production", "site"},
+	}
+
+	if len(file.Profiles) != len(expected) {
+		t.Fatalf("Profiles = %+v, want %d profiles", file.Profiles, len(expected))
+	}
+
+	for i, want := range expected {
+		got := file.Profiles[i]
+
+		if got.UserDirectory != want.userDirectory || got.Name != want.name || got.Bucket != want.bucket {
+			t.Errorf("Profiles[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestProfileStoreConcurrentAdd(t *testing.T) {
+	store := useConfigFile(t)
+	writers := 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			// each writer gets its own store, like separate processes would
+			other := &ProfileStore{Path: store.Path}
+			errs <- other.Add(SavedConfig{UserDirectory: "/site", Name: fmt.Sprintf("profile-%d", i)}, nil)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Add() error = %v", err)
+		}
+	}
+
+	file, err := store.Load()
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(file.Profiles) != writers {
+		t.Errorf("saved %d profiles, want %d", len(file.Profiles), writers)
+	}
+}
+
+func TestProfileStoreLock(t *testing.T) {
+	store := useConfigFile(t)
+	originalTimeout := lockTimeout
+	lockTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { lockTimeout = originalTimeout })
+
+	lockPath := store.Path + ".lock"
+	writeConfigFile(t, store, `{"profiles": []}`)
+
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Add(SavedConfig{Name: "held"}, nil); err == nil {
+		t.Errorf("Add() while another process holds the lock did not fail")
+	}
+
+	stale := time.Now().Add(-2 * lockStale)
+
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Add(SavedConfig{Name: "stale"}, nil); err != nil {
+		t.Errorf("Add() with a stale lock error = %v", err)
+	}
+}
+
+func TestProfileStoreLockOwnership(t *testing.T) {
+	store := useConfigFile(t)
+	lockPath := store.Path + ".lock"
+
+	unlock, err := store.lock()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another process broke the lock as stale and took its own
+	if err = os.WriteFile(lockPath, []byte("1 other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+
+	if data, err := os.ReadFile(lockPath); err != nil || string(data) != "1 other" {
+		t.Errorf("expected the lock of the other process to be kept, got %q (%v)", data, err)
+	}
+
+	if err = os.Remove(lockPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if unlock, err = store.lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+
+	if _, err = os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the own lock to be removed, got %v", err)
+	}
+}
+
+func TestProfileStoreLockStaysFresh(t *testing.T) {
+	store := useConfigFile(t)
+	originalStale := lockStale
+	lockStale = 60 * time.Millisecond
+	t.Cleanup(func() { lockStale = originalStale })
+
+	unlock, err := store.lock()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer unlock()
+
+	time.Sleep(3 * lockStale)
+
+	if info, err := os.Stat(store.Path + ".lock"); err != nil || time.Since(info.ModTime()) > lockStale {
+		t.Errorf("expected the held lock to be touched, got %v (%v)", info, err)
+	}
+}
+
+func TestBreakStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "config.json.lock")
+
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := time.Now().Add(-2 * lockStale)
+
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// both waiters saw the same stale lock, the first one breaks it
+	breakStaleLock(lockPath)
+
+	if _, err := os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the stale lock to be removed, got %v", err)
+	}
+
+	// and takes the lock before the second one breaks it as well
+	if err := os.WriteFile(lockPath, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	breakStaleLock(lockPath)
+
+	if data, err := os.ReadFile(lockPath); err != nil || string(data) != "first" {
+		t.Errorf("expected the lock of the first waiter to be kept, got %q (%v)", data, err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the lock file to be left, got %d files", len(entries))
+	}
+}
+
+func TestProfileStoreSave(t *testing.T) {
+	store := useConfigFile(t)
+	path := store.Path
+	file := &SavedConfigFile{Profiles: []SavedConfig{
+		{UserDirectory: "/site", Name: "production", Bucket: "bucket"},
+	}}
+
+	for i := 0; i < 2; i++ {
+		if err := store.Save(file); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+
+	if len(entries) != 1 {
+		t.Errorf("config directory has %d entries, want only config.json", len(entries))
+	}
+
+	read, err := store.Load()
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(read.Profiles) != 1 || read.Profiles[0].Bucket != "bucket" {
+		t.Errorf("Profiles = %+v, want the written profile", read.Profiles)
+	}
+}
+
+func TestSavedConfigFileProfile(t *testing.T) {
+	cwd, _ := filepath.Abs(".")
+	file := &SavedConfigFile{Profiles: []SavedConfig{
+		{UserDirectory: "/elsewhere", Name: "production"},
+		{UserDirectory: cwd, Name: "staging"},
+		{UserDirectory: cwd, Name: "production"},
+	}}
+
+	tests := []struct {
+		name     string
+		expected int
+	}{
+		{"production", 2},
+		{"staging", 1},
+		{"missing", -1},
+	}
+
+	for _, test := range tests {
+		i, err := file.Profile(test.name)
+
+		if i != test.expected {
+			t.Errorf("Profile(%q) = %d, want %d", test.name, i, test.expected)
+		}
+
+		if test.expected < 0 && !errors.Is(err, ErrConfigNotFound) {
+			t.Errorf("Profile(%q) error = %v, want ErrConfigNotFound", test.name, err)
+		}
+	}
+
+	if i := file.Find("production", "/elsewhere"); i != 0 {
+		t.Errorf("Find() = %d, want 0", i)
+	}
+}
@@ -0,0 +1,553 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	SecretBackendSecretService = "secret-service"
+	SecretBackendPass          = "pass"
+	SecretBackendFile          = "file"
+
+	DefaultSecretBackend = SecretBackendFile
+
+	// PassphraseEnv unlocks the file backend without a prompt, e.g. in scripts.
+	PassphraseEnv = "SYNC_S3_PASSPHRASE"
+)
+
+// SecretBackend keeps the access keys of saved profiles out of config.json, which only holds
+// a "<backend>:<key>" reference to them.
+type SecretBackend interface {
+	Name() string
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+// secretBackends builds a backend by name, tests add an in-memory one.
+var secretBackends = map[string]func() (SecretBackend, error){
+	SecretBackendSecretService: func() (SecretBackend, error) {
+		return &commandBackend{
+			name:    SecretBackendSecretService,
+			command: "secret-tool",
+			get: func(key string) []string {
+				return []string{"lookup", "service", "sync-s3", "profile", key}
+			},
+			set: func(key string) []string {
+				return []string{"store", "--label", "sync-s3 " + key, "service", "sync-s3", "profile", key}
+			},
+			delete: func(key string) []string {
+				return []string{"clear", "service", "sync-s3", "profile", key}
+			},
+		}, nil
+	},
+	SecretBackendPass: func() (SecretBackend, error) {
+		return &commandBackend{
+			name:    SecretBackendPass,
+			command: "pass",
+			get: func(key string) []string {
+				return []string{"show", "sync-s3/" + key}
+			},
+			set: func(key string) []string {
+				return []string{"insert", "--multiline", "--force", "sync-s3/" + key}
+			},
+			delete: func(key string) []string {
+				return []string{"rm", "--force", "sync-s3/" + key}
+			},
+		}, nil
+	},
+	SecretBackendFile: func() (SecretBackend, error) {
+		path, err := ConfigFilePath()
+
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(filepath.Dir(path), "secrets.enc")
+
+		// one backend per file, so the passphrase is only asked for once per run
+		if _, ok := fileBackends[path]; !ok {
+			fileBackends[path] = &fileBackend{path: path}
+		}
+
+		return fileBackends[path], nil
+	},
+}
+
+var fileBackends = map[string]*fileBackend{}
+
+// RegisterSecretBackend makes a backend available under name, for tests outside this package.
+func RegisterSecretBackend(name string, newBackend func() (SecretBackend, error)) {
+	secretBackends[name] = newBackend
+}
+
+func NewSecretBackend(name string) (SecretBackend, error) {
+	newBackend, ok := secretBackends[name]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown secret backend %q, use %s, %s or %s", name, SecretBackendSecretService, SecretBackendPass, SecretBackendFile)
+	}
+
+	return newBackend()
+}
+
+// profileSecret is the value stored in the backend for one profile.
+type profileSecret struct {
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+}
+
+func parseSecretRef(ref string) (string, string, error) {
+	name, key, ok := strings.Cut(ref, ":")
+
+	if !ok || name == "" || key == "" {
+		return "", "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+
+	return name, key, nil
+}
+
+// SecretRefBackend returns the backend a profile's secrets are stored in.
+func SecretRefBackend(ref string) (SecretBackend, error) {
+	name, _, err := parseSecretRef(ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSecretBackend(name)
+}
+
+// StoreSecrets moves the access keys of profile into backend, leaving only the reference in the
+// profile. A profile already stored in the same backend keeps its key.
+func StoreSecrets(backend SecretBackend, profile *SavedConfig) error {
+	if profile.AccessKeyID == "" && profile.SecretAccessKey == "" {
+		return nil
+	}
+
+	key := ""
+
+	if name, existing, err := parseSecretRef(profile.SecretRef); err == nil && name == backend.Name() {
+		key = existing
+	} else {
+		random := make([]byte, 16)
+
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+
+		key = hex.EncodeToString(random)
+	}
+
+	value, err := json.Marshal(profileSecret{profile.AccessKeyID, profile.SecretAccessKey})
+
+	if err != nil {
+		return err
+	}
+
+	if err = backend.Set(key, string(value)); err != nil {
+		return fmt.Errorf("storing secrets of profile %s in %s: %w", profile.Name, backend.Name(), err)
+	}
+
+	profile.SecretRef = backend.Name() + ":" + key
+	profile.AccessKeyID = ""
+	profile.SecretAccessKey = ""
+
+	return nil
+}
+
+// SharesSecrets reports whether another profile, like a copy made with config copy, uses the
+// secrets of profile i.
+func (file *SavedConfigFile) SharesSecrets(i int) bool {
+	ref := file.Profiles[i].SecretRef
+
+	if ref == "" {
+		return false
+	}
+
+	for j, profile := range file.Profiles {
+		if j != i && profile.SecretRef == ref {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnlockSecrets asks for the passphrase of backend, if it has one. Commands call it before
+// ProfileStore.Update, so nobody is typing a passphrase while the config file is locked.
+func UnlockSecrets(backend SecretBackend) error {
+	if file, ok := backend.(*fileBackend); ok {
+		_, err := file.load(true)
+		return err
+	}
+
+	return nil
+}
+
+// UnlockSecretRef is UnlockSecrets for the backend ref points at.
+func UnlockSecretRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+
+	backend, err := SecretRefBackend(ref)
+
+	if err != nil {
+		return err
+	}
+
+	return UnlockSecrets(backend)
+}
+
+// ResolveSecrets fills in the access keys of a profile from its secret backend.
+func ResolveSecrets(profile *SavedConfig) error {
+	if profile.SecretRef == "" {
+		return nil
+	}
+
+	name, key, err := parseSecretRef(profile.SecretRef)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCredentialsMissing, err)
+	}
+
+	backend, err := NewSecretBackend(name)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCredentialsMissing, err)
+	}
+
+	value, err := backend.Get(key)
+
+	if err != nil {
+		return fmt.Errorf("%w: reading secrets of profile %s from %s: %v", ErrCredentialsMissing, profile.Name, backend.Name(), err)
+	}
+
+	secret := profileSecret{}
+
+	if err = json.Unmarshal([]byte(value), &secret); err != nil {
+		return fmt.Errorf("%w: invalid secrets of profile %s in %s", ErrCredentialsMissing, profile.Name, backend.Name())
+	}
+
+	profile.AccessKeyID = secret.AccessKeyID
+	profile.SecretAccessKey = secret.SecretAccessKey
+
+	return nil
+}
+
+// DeleteSecrets removes the secrets ref points at.
+func DeleteSecrets(ref string) error {
+	name, key, err := parseSecretRef(ref)
+
+	if err != nil {
+		return err
+	}
+
+	backend, err := NewSecretBackend(name)
+
+	if err != nil {
+		return err
+	}
+
+	return backend.Delete(key)
+}
+
+// runSecretCommand runs a password manager with stdin and returns its output, swapped out in tests.
+var runSecretCommand = func(stdin string, name string, args ...string) (string, error) {
+	command := exec.Command(name, args...)
+	command.Stdin = strings.NewReader(stdin)
+
+	var out, errOut bytes.Buffer
+	command.Stdout = &out
+	command.Stderr = &errOut
+
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(errOut.String()); message != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, message)
+		}
+
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	return out.String(), nil
+}
+
+// commandBackend keeps secrets in a password manager through its command line: secret-tool
+// for the freedesktop Secret Service (GNOME Keyring, KWallet) or pass.
+type commandBackend struct {
+	name             string
+	command          string
+	get, set, delete func(key string) []string
+}
+
+func (backend *commandBackend) Name() string {
+	return backend.name
+}
+
+func (backend *commandBackend) Get(key string) (string, error) {
+	out, err := runSecretCommand("", backend.command, backend.get(key)...)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func (backend *commandBackend) Set(key, value string) error {
+	_, err := runSecretCommand(value, backend.command, backend.set(key)...)
+	return err
+}
+
+func (backend *commandBackend) Delete(key string) error {
+	_, err := runSecretCommand("", backend.command, backend.delete(key)...)
+	return err
+}
+
+// fileBackend keeps secrets in secrets.enc next to config.json, sealed with NaCl secretbox
+// under a key derived from a passphrase with scrypt. Writes hold the lock of config.json.
+type fileBackend struct {
+	path       string
+	passphrase []byte
+}
+
+// encryptedSecrets is the contents of secrets.enc.
+type encryptedSecrets struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Box   []byte `json:"box"`
+}
+
+// readPassphrase prompts on the terminal, swapped out in tests.
+var readPassphrase = func(prompt string) ([]byte, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no terminal to ask for the passphrase, set %s", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+
+	return passphrase, err
+}
+
+func (backend *fileBackend) Name() string {
+	return SecretBackendFile
+}
+
+// unlock returns the passphrase, asking twice when it will create the file.
+func (backend *fileBackend) unlock(create bool) ([]byte, error) {
+	if backend.passphrase != nil {
+		return backend.passphrase, nil
+	}
+
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		backend.passphrase = []byte(env)
+		return backend.passphrase, nil
+	}
+
+	passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for %s: ", backend.path))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	if create {
+		confirm, err := readPassphrase("Repeat passphrase: ")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(passphrase, confirm) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	backend.passphrase = passphrase
+
+	return passphrase, nil
+}
+
+func deriveKey(passphrase, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := [32]byte{}
+	copy(key[:], derived)
+
+	return &key, nil
+}
+
+func (backend *fileBackend) load(create bool) (map[string]string, error) {
+	data, err := os.ReadFile(backend.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return map[string]string{}, nil
+		}
+
+		if _, err = backend.unlock(true); err != nil {
+			return nil, err
+		}
+
+		return map[string]string{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := encryptedSecrets{}
+
+	if err = json.Unmarshal(data, &sealed); err != nil || len(sealed.Nonce) != 24 {
+		return nil, fmt.Errorf("invalid secrets file %s", backend.path)
+	}
+
+	passphrase, err := backend.unlock(false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, sealed.Salt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := [24]byte{}
+	copy(nonce[:], sealed.Nonce)
+
+	opened, ok := secretbox.Open(nil, sealed.Box, &nonce, key)
+
+	if !ok {
+		backend.passphrase = nil
+		return nil, fmt.Errorf("wrong passphrase for %s", backend.path)
+	}
+
+	secrets := map[string]string{}
+
+	if err = json.Unmarshal(opened, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid secrets file %s", backend.path)
+	}
+
+	return secrets, nil
+}
+
+func (backend *fileBackend) save(secrets map[string]string) error {
+	passphrase, err := backend.unlock(false)
+
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(secrets)
+
+	if err != nil {
+		return err
+	}
+
+	sealed := encryptedSecrets{Salt: make([]byte, 16), Nonce: make([]byte, 24)}
+
+	if _, err = io.ReadFull(rand.Reader, sealed.Salt); err != nil {
+		return err
+	}
+
+	if _, err = io.ReadFull(rand.Reader, sealed.Nonce); err != nil {
+		return err
+	}
+
+	key, err := deriveKey(passphrase, sealed.Salt)
+
+	if err != nil {
+		return err
+	}
+
+	nonce := [24]byte{}
+	copy(nonce[:], sealed.Nonce)
+	sealed.Box = secretbox.Seal(nil, plain, &nonce, key)
+
+	data, err := json.MarshalIndent(sealed, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(backend.path, data)
+}
+
+func (backend *fileBackend) Get(key string) (string, error) {
+	secrets, err := backend.load(false)
+
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secrets[key]
+
+	if !ok {
+		return "", fmt.Errorf("no secret %s in %s", key, backend.path)
+	}
+
+	return value, nil
+}
+
+func (backend *fileBackend) Set(key, value string) error {
+	return backend.configStore().withLock(func() error {
+		secrets, err := backend.load(true)
+
+		if err != nil {
+			return err
+		}
+
+		secrets[key] = value
+
+		return backend.save(secrets)
+	})
+}
+
+func (backend *fileBackend) Delete(key string) error {
+	return backend.configStore().withLock(func() error {
+		secrets, err := backend.load(false)
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := secrets[key]; !ok {
+			return nil
+		}
+
+		delete(secrets, key)
+
+		return backend.save(secrets)
+	})
+}
+
+// configStore is the store of the config file next to the secrets, whose lock they share.
+func (backend *fileBackend) configStore() *ProfileStore {
+	return &ProfileStore{Path: filepath.Join(filepath.Dir(backend.path), "config.json")}
+}
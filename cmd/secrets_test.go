@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryBackend is a SecretBackend for tests.
+type memoryBackend map[string]string
+
+func (backend memoryBackend) Name() string {
+	return "memory"
+}
+
+func (backend memoryBackend) Get(key string) (string, error) {
+	value, ok := backend[key]
+
+	if !ok {
+		return "", errors.New("no such secret")
+	}
+
+	return value, nil
+}
+
+func (backend memoryBackend) Set(key, value string) error {
+	backend[key] = value
+	return nil
+}
+
+func (backend memoryBackend) Delete(key string) error {
+	delete(backend, key)
+	return nil
+}
+
+// useMemoryBackend registers a memory backend for the test.
+func useMemoryBackend(t *testing.T) memoryBackend {
+	t.Helper()
+
+	backend := memoryBackend{}
+	secretBackends["memory"] = func() (SecretBackend, error) { return backend, nil }
+	t.Cleanup(func() { delete(secretBackends, "memory") })
+
+	return backend
+}
+
+func TestStoreAndResolveSecrets(t *testing.T) {
+	backend := useMemoryBackend(t)
+	profile := SavedConfig{Name: "production", AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}
+
+	if err := StoreSecrets(backend, &profile); err != nil {
+		t.Fatalf("StoreSecrets() error = %v", err)
+	}
+
+	if profile.AccessKeyID != "" || profile.SecretAccessKey != "" {
+		t.Errorf("StoreSecrets() left plaintext keys in %+v", profile)
+	}
+
+	if !strings.HasPrefix(profile.SecretRef, "memory:") || len(backend) != 1 {
+		t.Errorf("SecretRef = %q with %d stored secrets, want one memory secret", profile.SecretRef, len(backend))
+	}
+
+	ref := profile.SecretRef
+	profile.SecretAccessKey = "rotated"
+
+	if err := StoreSecrets(backend, &profile); err != nil {
+		t.Fatalf("StoreSecrets() error = %v", err)
+	}
+
+	if profile.SecretRef != ref || len(backend) != 1 {
+		t.Errorf("storing again changed the reference from %q to %q", ref, profile.SecretRef)
+	}
+
+	if err := ResolveSecrets(&profile); err != nil {
+		t.Fatalf("ResolveSecrets() error = %v", err)
+	}
+
+	if profile.AccessKeyID != "" || profile.SecretAccessKey != "rotated" {
+		t.Errorf("ResolveSecrets() = %q, %q, want the stored keys", profile.AccessKeyID, profile.SecretAccessKey)
+	}
+
+	if err := DeleteSecrets(ref); err != nil || len(backend) != 0 {
+		t.Errorf("DeleteSecrets() error = %v, %d secrets left", err, len(backend))
+	}
+}
+
+func TestSharesSecrets(t *testing.T) {
+	backend := useMemoryBackend(t)
+	original := SavedConfig{Name: "production", AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}
+
+	if err := StoreSecrets(backend, &original); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := original
+	copied.UserDirectory = "/site-hotfix"
+	file := &SavedConfigFile{Profiles: []SavedConfig{original, copied, {Name: "staging"}}}
+
+	for i, expected := range []bool{true, true, false} {
+		if shared := file.SharesSecrets(i); shared != expected {
+			t.Errorf("SharesSecrets(%d) = %v, want %v", i, shared, expected)
+		}
+	}
+
+	// editing the copy the way config edit does stores its keys under a new reference
+	profile := &file.Profiles[1]
+	profile.SecretRef = ""
+	profile.AccessKeyID, profile.SecretAccessKey = "AKIAOTHER", "other"
+
+	if err := StoreSecrets(backend, profile); err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.SecretRef == original.SecretRef || file.SharesSecrets(0) {
+		t.Errorf("expected the copy to get its own reference, got %q", profile.SecretRef)
+	}
+
+	resolved := file.Profiles[0]
+
+	if err := ResolveSecrets(&resolved); err != nil || resolved.AccessKeyID != "AKIAEXAMPLE" {
+		t.Errorf("expected the original keys to be unchanged, got %q (%v)", resolved.AccessKeyID, err)
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	useMemoryBackend(t)
+
+	refs := []string{"memory:missing", "unknown:key", "no-key"}
+
+	for _, ref := range refs {
+		profile := SavedConfig{Name: "production", SecretRef: ref}
+
+		if err := ResolveSecrets(&profile); !errors.Is(err, ErrCredentialsMissing) {
+			t.Errorf("ResolveSecrets(%q) error = %v, want ErrCredentialsMissing", ref, err)
+		}
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	t.Setenv(PassphraseEnv, "correct horse")
+
+	backend := &fileBackend{path: path}
+
+	if err := backend.Set("a", "first"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if err := backend.Set("b", "second"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "first") {
+		t.Errorf("secrets file holds a plaintext value")
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	reopened := &fileBackend{path: path}
+
+	if value, err := reopened.Get("b"); err != nil || value != "second" {
+		t.Errorf("Get() = %q, %v, want second", value, err)
+	}
+
+	if err := reopened.Delete("a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if _, err := reopened.Get("a"); err == nil {
+		t.Errorf("Get() of a deleted secret did not fail")
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+
+	if _, err := (&fileBackend{path: path}).Get("b"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Get() with the wrong passphrase error = %v", err)
+	}
+}
+
+func TestFileBackendPrompt(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+
+	prompts := []string{}
+	answers := []string{"one", "two"}
+	original := readPassphrase
+	readPassphrase = func(prompt string) ([]byte, error) {
+		prompts = append(prompts, prompt)
+		answer := answers[0]
+		answers = answers[1:]
+
+		return []byte(answer), nil
+	}
+	t.Cleanup(func() { readPassphrase = original })
+
+	backend := &fileBackend{path: filepath.Join(t.TempDir(), "secrets.enc")}
+
+	if err := backend.Set("a", "value"); err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("Set() with mismatched passphrases error = %v", err)
+	}
+
+	if len(prompts) != 2 {
+		t.Errorf("asked %d times for a new passphrase, want 2", len(prompts))
+	}
+}
+
+func TestAddAsksForPassphraseBeforeLocking(t *testing.T) {
+	store := useConfigFile(t)
+	t.Setenv(PassphraseEnv, "")
+
+	prompts := 0
+	original := readPassphrase
+	readPassphrase = func(prompt string) ([]byte, error) {
+		prompts++
+
+		if _, err := os.Stat(store.Path + ".lock"); err == nil {
+			t.Errorf("asked %q while the config file is locked", prompt)
+		}
+
+		return []byte("passphrase"), nil
+	}
+	t.Cleanup(func() { readPassphrase = original })
+
+	backend, err := NewSecretBackend(SecretBackendFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Add(SavedConfig{Name: "production", AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}, backend); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if prompts != 2 {
+		t.Errorf("asked %d times for a new passphrase, want 2", prompts)
+	}
+}
+
+func TestFileBackendSharesConfigLock(t *testing.T) {
+	store := useConfigFile(t)
+	t.Setenv(PassphraseEnv, "correct horse")
+	originalTimeout := lockTimeout
+	lockTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { lockTimeout = originalTimeout })
+
+	backend, err := NewSecretBackend(SecretBackendFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(store.Path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process is changing the config file
+	if err = os.WriteFile(store.Path+".lock", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = backend.Set("a", "value"); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("Set() while another process holds the lock error = %v", err)
+	}
+
+	if err = os.Remove(store.Path + ".lock"); err != nil {
+		t.Fatal(err)
+	}
+
+	// inside Update this process already holds the lock
+	err = store.Update(func(file *SavedConfigFile) error {
+		return backend.Set("a", "value")
+	})
+
+	if err != nil {
+		t.Errorf("Set() inside Update error = %v", err)
+	}
+}
+
+func TestCommandBackend(t *testing.T) {
+	calls := [][]string{}
+	original := runSecretCommand
+	runSecretCommand = func(stdin string, name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{stdin, name}, args...))
+		return "value\n", nil
+	}
+	t.Cleanup(func() { runSecretCommand = original })
+
+	backend, err := NewSecretBackend(SecretBackendPass)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = backend.Set("key", "value")
+	value, _ := backend.Get("key")
+	_ = backend.Delete("key")
+
+	if value != "value" {
+		t.Errorf("Get() = %q, want the output without the newline", value)
+	}
+
+	expected := [][]string{
+		{"value", "pass", "insert", "--multiline", "--force", "sync-s3/key"},
+		{"", "pass", "show", "sync-s3/key"},
+		{"", "pass", "rm", "--force", "sync-s3/key"},
+	}
+
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("commands = %v, want %v", calls, expected)
+	}
+}
+
+func TestLoadConfigFromFileSecrets(t *testing.T) {
+	store := useConfigFile(t)
+	useMemoryBackend(t)
+
+	backend, _ := NewSecretBackend("memory")
+	cwd, _ := filepath.Abs(".")
+	profile := SavedConfig{UserDirectory: cwd, Name: "production", Bucket: "bucket", AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}
+
+	if err := store.Add(profile, backend); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(store.Path)
+
+	if strings.Contains(string(data), "AKIAEXAMPLE") || !strings.Contains(string(data), `"secretRef": "memory:`) {
+		t.Errorf("config file = %s, want only a secret reference", data)
+	}
+
+	config, err := LoadConfigFromFile("production")
+
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile() error = %v", err)
+	}
+
+	if config.AccessKeyID != "AKIAEXAMPLE" || config.SecretAccessKey != "secret" {
+		t.Errorf("keys = %q, %q, want the stored keys", config.AccessKeyID, config.SecretAccessKey)
+	}
+}
@@ -1,11 +1,7 @@
 package setup
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
-	"os"
-	"os/user"
 	"path/filepath"
 
 	"github.com/alrudolph/snyc-static-site-s3/cmd"
@@ -24,7 +20,7 @@ var setupCmd = &cobra.Command{
 	// Example Usage:
 	// 	go run . --directory /path/to/static/site --bucket s3-bucket-name
 	// `,
-	Run: func(command *cobra.Command, args []string) {
+	RunE: func(command *cobra.Command, args []string) error {
 		if len(args) > 0 {
 			fmt.Println("Additional supplied args will be ignored")
 		}
@@ -32,14 +28,14 @@ var setupCmd = &cobra.Command{
 		config, err := cmd.NewConfig(command, args)
 
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		configName, _ := command.Flags().GetString("config-name")
 		userDirectory, err := filepath.Abs(".")
 
 		if err != nil {
-			log.Fatalf("Error getting relative path: %v", err)
+			return fmt.Errorf("error getting relative path: %w", err)
 		}
 
 		toSave := cmd.SavedConfig{
@@ -52,87 +48,27 @@ var setupCmd = &cobra.Command{
 			Role:            config.Role,
 			Bucket:          config.Bucket,
 			Directory:       config.Directory,
+			DistributionID:  config.DistributionID,
+			Headers:         config.Headers,
+			HTMLKeys:        config.Keys.Mode,
+			HTMLExempt:      config.Keys.Exempt,
+			Preserve:        config.Preserve,
 		}
 
-		file := cmd.SavedConfigFile{}
-
-		usr, err := user.Current()
-
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-
-		homeDir := usr.HomeDir
-
-		// if file doesn't exist, create
-		fileName := filepath.Join(homeDir, "sync-s3", "config.json")
-
-		if _, err := os.Stat(fileName); os.IsNotExist(err) {
-			if os.MkdirAll(filepath.Join(homeDir, "sync-s3"), os.ModePerm) != nil {
-				log.Fatal(err)
-				return
-			}
-
-			newFile, err := os.Create(fileName)
-			if err != nil {
-				log.Fatal(err)
-				newFile.Close()
-				return
-			}
-			newFile.Close()
-
-			err = os.WriteFile(fileName, []byte(`{"profiles": []}`), 0644)
-			if err != nil {
-				log.Fatal(err)
-				return
-			}
-		}
-
-		// Read from file
-		configFile, err := os.Open(fileName)
+		backendName, _ := command.Flags().GetString("secret-backend")
+		secrets, err := cmd.NewSecretBackend(backendName)
 
 		if err != nil {
-			log.Fatal(err)
-			configFile.Close()
-			return
+			return err
 		}
 
-		savedConfig := cmd.SavedConfigFile{}
-
-		// load json into struct
-		jsonParser := json.NewDecoder(configFile)
-		if err = jsonParser.Decode(&savedConfig); err != nil {
-			log.Fatal(err)
-			configFile.Close()
-			return
-		}
-		configFile.Close()
-
-		// already have this config, ignore
-		for _, profile := range savedConfig.Profiles {
-			if profile.Name == toSave.Name && profile.UserDirectory == toSave.UserDirectory {
-				log.Fatal("Profile already exists")
-				return
-			}
-		}
-
-		// add new data
-		file.Profiles = append(file.Profiles, toSave)
-
-		// write struct to file
-		writeToFile, err := json.Marshal(file)
+		store, err := cmd.NewProfileStore()
 
 		if err != nil {
-			log.Fatal(err)
-			return
+			return err
 		}
 
-		err = os.WriteFile(fileName, writeToFile, 0644)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
+		return store.Add(toSave, secrets)
 	},
 }
 
@@ -151,8 +87,14 @@ func init() {
 
 	setupCmd.Flags().String("access-key-id", "", "AWS Access Key ID")
 	setupCmd.Flags().String("secret-access-key", "", "AWS Secret Access Key")
+	setupCmd.Flags().String("secret-backend", cmd.DefaultSecretBackend, "Where access keys are stored: secret-service, pass or file (encrypted with a passphrase)")
 	setupCmd.Flags().StringP("profile", "p", "", "AWS Profile name")
 	setupCmd.Flags().StringP("role", "", "", "Role to switch into")
+	setupCmd.Flags().String("distribution-id", "", "CloudFront distribution to invalidate")
+	setupCmd.Flags().String("html-keys", cmd.HTMLStripExtension, "How html files map to keys: strip-extension, directory-index, both or keep")
+	setupCmd.Flags().StringSlice("html-exempt", cmd.DefaultHTMLExempt, "html file names that keep their name at any depth")
+	setupCmd.Flags().StringArray("preserve", nil, "Never remove remote keys matching this glob, relative to the prefix (repeatable)")
+	setupCmd.Flags().StringArray("header", nil, "Header rule <glob>:<header>=<value>, e.g. '*.html:Cache-Control=no-cache' (repeatable)")
 
 	cmd.RootCmd.AddCommand(setupCmd)
 }
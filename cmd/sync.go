@@ -0,0 +1,458 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// LocalFile is a file in the site directory along with the object key it maps to.
+// Name is the slash separated path relative to the site directory.
+type LocalFile struct {
+	Path     string
+	Name     string
+	Key      string
+	MimeType string
+	Size     int64
+	ETag     string
+
+	// ContentEncoding is set when the uploaded body is compressed, either on the fly
+	// (Compress) or because Path is a pre-compressed sibling of the original file.
+	ContentEncoding string
+	Compress        bool
+
+	// compressed is the body of a Compress file, kept from computing its ETag so the
+	// upload does not compress it again.
+	compressed []byte
+}
+
+// RemoteObject is an object that already exists in the bucket. Headers is the headerHash
+// it was uploaded with, only known when it comes from a manifest.
+type RemoteObject struct {
+	Key     string
+	Size    int64
+	ETag    string
+	Headers string
+}
+
+// SyncPlan describes the changes needed to make the bucket match the local directory.
+// Protected objects are orphaned but are kept because they match an ignore or preserve rule.
+// Applied is filled in by SyncDirectory with the keys that were actually uploaded or removed.
+type SyncPlan struct {
+	Adds      []LocalFile
+	Updates   []LocalFile
+	Deletes   []RemoteObject
+	Unchanged []LocalFile
+	Protected []RemoteObject
+	Applied   []string
+
+	remote map[string]RemoteObject
+}
+
+func (plan *SyncPlan) Uploads() []LocalFile {
+	return append(append([]LocalFile{}, plan.Adds...), plan.Updates...)
+}
+
+func (plan *SyncPlan) DeleteKeys() []string {
+	keys := make([]string, 0, len(plan.Deletes))
+
+	for _, obj := range plan.Deletes {
+		keys = append(keys, obj.Key)
+	}
+
+	return keys
+}
+
+// ChangedKeys are the keys the plan would upload or remove.
+func (plan *SyncPlan) ChangedKeys() []string {
+	keys := plan.DeleteKeys()
+
+	for _, file := range plan.Uploads() {
+		keys = append(keys, file.Key)
+	}
+
+	return keys
+}
+
+func SyncDirectory(directory, bucket, prefix string, options UploadOptions, client S3API, ctx context.Context) (*SyncPlan, error) {
+	plan, err := PlanSync(directory, bucket, prefix, options, client, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = plan.updateDrifted(bucket, options, client, ctx); err != nil {
+		return nil, err
+	}
+
+	emit(&PlanEvent{
+		Bucket:    bucket,
+		Prefix:    prefix,
+		New:       len(plan.Adds),
+		Changed:   len(plan.Updates),
+		Unchanged: len(plan.Unchanged),
+		Remove:    len(plan.Deletes),
+		Kept:      len(plan.Protected),
+	})
+
+	// checked before uploading so a refused sync changes nothing
+	if err := options.Limits.Check(plan); err != nil {
+		return nil, err
+	}
+
+	summary := UploadFiles(plan.Uploads(), bucket, options, client, ctx)
+	summary.Print()
+
+	for _, file := range summary.Succeeded {
+		plan.Applied = append(plan.Applied, file.Key)
+	}
+
+	if err := summary.Err(); err != nil {
+		message("skipping removals since not every upload succeeded")
+		return plan, fmt.Errorf("%w: %w", ErrPartialUpload, err)
+	}
+
+	// deletes happen last so the site never references a missing object mid-deploy
+	err = DeleteObjects(bucket, plan.DeleteKeys(), client, ctx)
+	plan.Applied = append(plan.Applied, removedKeys(plan.DeleteKeys(), err)...)
+
+	if err != nil {
+		return plan, fmt.Errorf("%w: %w", ErrPartialUpload, err)
+	}
+
+	return plan, nil
+}
+
+// removedKeys leaves out the keys a *DeleteError reports as failed.
+func removedKeys(keys []string, err error) []string {
+	var deleteErr *DeleteError
+
+	if !errors.As(err, &deleteErr) {
+		return keys
+	}
+
+	failed := map[string]bool{}
+
+	for _, failure := range deleteErr.Failures {
+		failed[failure.Key] = true
+	}
+
+	removed := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if !failed[key] {
+			removed = append(removed, key)
+		}
+	}
+
+	return removed
+}
+
+// PlanSync compares the directory with the bucket. An empty directory means every
+// object under the prefix would be removed.
+func PlanSync(directory, bucket, prefix string, options UploadOptions, client S3API, ctx context.Context) (*SyncPlan, error) {
+	var local []LocalFile
+
+	if directory != "" {
+		files, err := ListLocalFiles(directory, prefix, options)
+
+		if err != nil {
+			return nil, err
+		}
+
+		local = files
+	}
+
+	remote, err := listRemote(bucket, prefix, options.FromManifest, client, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plan := diffFiles(local, remote)
+	plan.remote = remote
+	plan.protect(prefix, options.protectRules())
+
+	return plan, nil
+}
+
+// protect keeps orphaned objects matched by rules.
+func (plan *SyncPlan) protect(prefix string, rules ProtectRules) {
+	deletes := plan.Deletes[:0]
+
+	for _, obj := range plan.Deletes {
+		if rules.Protects(obj.Key, prefix) {
+			plan.Protected = append(plan.Protected, obj)
+		} else {
+			deletes = append(deletes, obj)
+		}
+	}
+
+	plan.Deletes = deletes
+}
+
+// updateDrifted moves unchanged files whose headers differ from the object's into Updates,
+// so a new header rule also reaches files whose content is the same. Objects listed in a
+// manifest are compared with the headers it recorded, others are only checked with
+// HeadObject when there are header rules that could have changed.
+func (plan *SyncPlan) updateDrifted(bucket string, options UploadOptions, client S3API, ctx context.Context) error {
+	drifted := map[string]bool{}
+	var unknown []LocalFile
+
+	for _, file := range plan.Unchanged {
+		recorded := plan.remote[file.Key].Headers
+
+		if recorded == "" {
+			unknown = append(unknown, file)
+			continue
+		}
+
+		hash, err := headerHash(file, options)
+
+		if err != nil {
+			return err
+		}
+
+		drifted[file.Key] = hash != recorded
+	}
+
+	if len(unknown) > 0 && len(options.Headers) > 0 {
+		drift, err := metadataDrift(unknown, bucket, options, client, ctx)
+
+		if err != nil {
+			return err
+		}
+
+		for _, found := range drift {
+			drifted[found.Key] = true
+		}
+	}
+
+	unchanged := plan.Unchanged[:0]
+
+	for _, file := range plan.Unchanged {
+		if drifted[file.Key] {
+			plan.Updates = append(plan.Updates, file)
+		} else {
+			unchanged = append(unchanged, file)
+		}
+	}
+
+	plan.Unchanged = unchanged
+
+	return nil
+}
+
+func diffFiles(local []LocalFile, remote map[string]RemoteObject) *SyncPlan {
+	plan := &SyncPlan{}
+	seen := map[string]bool{}
+
+	for _, file := range local {
+		seen[file.Key] = true
+		obj, exists := remote[file.Key]
+
+		switch {
+		case !exists:
+			plan.Adds = append(plan.Adds, file)
+		case obj.Size != file.Size || obj.ETag != file.ETag:
+			plan.Updates = append(plan.Updates, file)
+		default:
+			plan.Unchanged = append(plan.Unchanged, file)
+		}
+	}
+
+	for key, obj := range remote {
+		if !seen[key] {
+			plan.Deletes = append(plan.Deletes, obj)
+		}
+	}
+
+	sort.Slice(plan.Deletes, func(i, j int) bool {
+		return plan.Deletes[i].Key < plan.Deletes[j].Key
+	})
+
+	return plan
+}
+
+// ListLocalFiles lists the files that would be uploaded, with the size and MD5 of the
+// body that would be sent so they can be compared with the objects' ETags.
+func ListLocalFiles(directory, prefix string, options UploadOptions) ([]LocalFile, error) {
+	var files []LocalFile
+
+	err := filepath.Walk(
+		directory,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name, err := filepath.Rel(directory, path)
+
+			if err != nil {
+				return err
+			}
+
+			if name != "." && options.Ignore.Excluded(filepath.ToSlash(name)) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			mapped, err := newLocalFiles(directory, path, prefix, options.Keys)
+
+			if err != nil {
+				return err
+			}
+
+			for _, file := range mapped {
+				file.Size = info.Size()
+				files = append(files, file)
+			}
+
+			return nil
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files = applyCompression(files, options.Compression)
+
+	for i := range files {
+		if err := files[i].computeETag(options.Multipart); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// computeETag sets the size and ETag of the body that would be uploaded, using the
+// multipart ETag format for files that would be uploaded in parts.
+func (file *LocalFile) computeETag(options MultipartOptions) error {
+	var body io.ReadSeeker
+
+	if file.Compress {
+		compressed, err := compressFile(file.Path, file.ContentEncoding)
+
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(compressed)
+		file.Size = int64(len(compressed))
+		file.compressed = compressed
+	} else {
+		f, err := os.Open(file.Path)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		body = f
+	}
+
+	var err error
+
+	if options.useMultipart(file.Size) {
+		file.ETag, err = multipartETag(body, options.partSize(file.Size))
+		return err
+	}
+
+	hash := md5.New()
+
+	if _, err = io.Copy(hash, body); err != nil {
+		return err
+	}
+
+	file.ETag = hex.EncodeToString(hash.Sum(nil))
+
+	return nil
+}
+
+func ListRemoteObjects(bucket, prefix string, client S3API, ctx context.Context) (map[string]RemoteObject, error) {
+	objects := map[string]RemoteObject{}
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(listPrefix(prefix)),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			objects[*obj.Key] = RemoteObject{
+				Key:  *obj.Key,
+				Size: aws.ToInt64(obj.Size),
+				ETag: strings.Trim(aws.ToString(obj.ETag), `"`),
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// listRemote lists the objects under the prefix, leaving out the reserved directory. With
+// fromManifest the latest manifest is used instead, unless there is none for the prefix.
+func listRemote(bucket, prefix string, fromManifest bool, client S3API, ctx context.Context) (map[string]RemoteObject, error) {
+	var remote map[string]RemoteObject
+	var err error
+
+	if fromManifest {
+		if remote, err = manifestObjects(bucket, prefix, client, ctx); err != nil {
+			return nil, err
+		}
+
+		if remote == nil {
+			message("no manifest found, listing the bucket instead")
+		}
+	}
+
+	if remote == nil {
+		if remote, err = ListRemoteObjects(bucket, prefix, client, ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for key := range remote {
+		if isReserved(key, prefix) {
+			delete(remote, key)
+		}
+	}
+
+	return remote, nil
+}
+
+// listPrefix makes sure a prefix like "site" does not also match keys under "site2/".
+func listPrefix(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+
+	return prefix + "/"
+}
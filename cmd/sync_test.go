@@ -0,0 +1,52 @@
+package cmd
+
+import "testing"
+
+func TestDiffFiles(t *testing.T) {
+	local := []LocalFile{
+		{Key: "index.html", Size: 10, ETag: "aaa"},
+		{Key: "about", Size: 20, ETag: "bbb"},
+		{Key: "styles.css", Size: 30, ETag: "ccc"},
+	}
+
+	remote := map[string]RemoteObject{
+		"index.html": {Key: "index.html", Size: 10, ETag: "aaa"},
+		"about":      {Key: "about", Size: 20, ETag: "old"},
+		"old-page":   {Key: "old-page", Size: 5, ETag: "ddd"},
+	}
+
+	plan := diffFiles(local, remote)
+
+	if len(plan.Adds) != 1 || plan.Adds[0].Key != "styles.css" {
+		t.Errorf("expected styles.css to be added, got %v", plan.Adds)
+	}
+
+	if len(plan.Updates) != 1 || plan.Updates[0].Key != "about" {
+		t.Errorf("expected about to be updated, got %v", plan.Updates)
+	}
+
+	if len(plan.Unchanged) != 1 || plan.Unchanged[0].Key != "index.html" {
+		t.Errorf("expected index.html to be unchanged, got %v", plan.Unchanged)
+	}
+
+	if len(plan.Deletes) != 1 || plan.Deletes[0].Key != "old-page" {
+		t.Errorf("expected old-page to be deleted, got %v", plan.Deletes)
+	}
+}
+
+func TestListPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+	}{
+		{"", ""},
+		{"site", "site/"},
+		{"site/", "site/"},
+	}
+
+	for _, test := range tests {
+		if got := listPrefix(test.prefix); got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
@@ -1,49 +1,177 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"mime"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-func UploadFile(baseDirectory, path, bucketName, prefix string, client *s3.Client, ctx context.Context) error {
-	fileName, err := filepath.Rel(baseDirectory, path)
+// putObjectInput has the headers localFile is uploaded with, everything but the body.
+func putObjectInput(localFile LocalFile, bucketName string, options UploadOptions) (*s3.PutObjectInput, error) {
+	obj := &s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(localFile.Key),
+		ContentType: aws.String(localFile.MimeType),
+	}
+
+	if localFile.ContentEncoding != "" {
+		obj.ContentEncoding = aws.String(localFile.ContentEncoding)
+	}
+
+	if err := applyHeaderRules(options.Headers, localFile.Name, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// headerHash identifies the headers localFile is uploaded with, so a manifest can record them
+// and a later sync can tell that a header rule changed without asking S3.
+func headerHash(localFile LocalFile, options UploadOptions) (string, error) {
+	obj, err := putObjectInput(localFile, "", options)
 
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	headers := []string{
+		aws.ToString(obj.ContentType),
+		aws.ToString(obj.ContentEncoding),
+		aws.ToString(obj.CacheControl),
+		aws.ToString(obj.ContentDisposition),
+		aws.ToString(obj.ContentLanguage),
+	}
+
+	if obj.Expires != nil {
+		headers = append(headers, obj.Expires.UTC().Format(time.RFC3339))
+	} else {
+		headers = append(headers, "")
+	}
+
+	names := make([]string, 0, len(obj.Metadata))
+
+	for name := range obj.Metadata {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		headers = append(headers, name+"="+obj.Metadata[name])
 	}
 
-	keyName, mimeType := getObjectKeyType(fileName)
+	hash := sha256.Sum256([]byte(strings.Join(headers, "\n")))
+
+	return hex.EncodeToString(hash[:8]), nil
+}
+
+// uploadLocalFile uploads localFile and reports how long it took and how many bytes were sent.
+func uploadLocalFile(localFile LocalFile, bucketName string, options UploadOptions, client S3API, ctx context.Context) error {
+	started := time.Now()
+	size, err := putLocalFile(localFile, bucketName, options, client, ctx)
 
-	if prefix != "" {
-		keyName = filepath.Join(prefix, keyName)
+	event := &UploadEvent{
+		Key:        localFile.Key,
+		MimeType:   localFile.MimeType,
+		Bytes:      size,
+		DurationMs: time.Since(started).Milliseconds(),
 	}
 
-	fmt.Printf("> uploading %s - %s\n", keyName, mimeType)
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	emit(event)
+
+	return err
+}
 
-	file, err := os.Open(path)
+func putLocalFile(localFile LocalFile, bucketName string, options UploadOptions, client S3API, ctx context.Context) (int64, error) {
+	file, err := os.Open(localFile.Path)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	defer file.Close()
 
-	obj := &s3.PutObjectInput{
-		Bucket:      aws.String(bucketName),
-		Key:         aws.String(keyName),
-		Body:        file,
-		ContentType: aws.String(mimeType),
+	info, err := file.Stat()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var body interface {
+		io.Reader
+		io.ReaderAt
+	} = file
+	size := info.Size()
+
+	if localFile.Compress {
+		compressed := localFile.compressed
+
+		if compressed == nil {
+			compressed, err = compressFile(localFile.Path, localFile.ContentEncoding)
+
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		body = bytes.NewReader(compressed)
+		size = int64(len(compressed))
+	}
+
+	obj, err := putObjectInput(localFile, bucketName, options)
+
+	if err != nil {
+		return 0, err
+	}
+
+	obj.Body = body
+
+	if options.Multipart.useMultipart(size) {
+		return size, uploadMultipart(obj, body, size, options.Multipart, client, ctx)
 	}
 
 	_, err = client.PutObject(ctx, obj)
 
-	return err
+	return size, err
+}
+
+// newLocalFiles maps a file in baseDirectory to the object keys it is uploaded under.
+func newLocalFiles(baseDirectory, path, prefix string, strategy KeyStrategy) ([]LocalFile, error) {
+	fileName, err := filepath.Rel(baseDirectory, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fileName = filepath.ToSlash(fileName)
+	mimeType := mime.TypeByExtension(filepath.Ext(fileName))
+
+	var files []LocalFile
+
+	for _, keyName := range strategy.Keys(fileName) {
+		if prefix != "" {
+			keyName = filepath.ToSlash(filepath.Join(prefix, keyName))
+		}
+
+		files = append(files, LocalFile{Path: path, Name: fileName, Key: keyName, MimeType: mimeType})
+	}
+
+	return files, nil
 }
 
 func getObjectKeyType(fileName string) (outputFileName, mimeType string) {
@@ -51,15 +179,7 @@ func getObjectKeyType(fileName string) (outputFileName, mimeType string) {
 	// require use to access domain.com/file.html instead of domain.com/file
 	// we make an exception for "index.html" and "error.html"
 	mimeType = mime.TypeByExtension(filepath.Ext(fileName))
-	outputFileName = fileName
-
-	if fileName == "index.html" || fileName == "error.html" {
-		return
-	}
-
-	if filepath.Ext(fileName) == ".html" {
-		outputFileName = fileName[:len(fileName)-5]
-	}
+	outputFileName = DefaultKeyStrategy().Keys(fileName)[0]
 
 	return
 }
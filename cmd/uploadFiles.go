@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const DefaultConcurrency = 8
+
+type UploadOptions struct {
+	Keys        KeyStrategy
+	Ignore      *IgnoreRules
+	Preserve    []string
+	Concurrency int
+	Headers     []HeaderRule
+	Compression CompressOptions
+	Multipart   MultipartOptions
+	Limits      DeleteLimits
+
+	// FromManifest diffs against the latest deploy manifest instead of listing the bucket.
+	FromManifest bool
+}
+
+type UploadFailure struct {
+	File LocalFile
+	Err  error
+}
+
+type UploadSummary struct {
+	Succeeded []LocalFile
+	Failed    []UploadFailure
+}
+
+func (options UploadOptions) protectRules() ProtectRules {
+	return ProtectRules{Ignore: options.Ignore, Preserve: options.Preserve}
+}
+
+// Err joins every per-file failure, or returns nil if all uploads succeeded.
+func (summary *UploadSummary) Err() error {
+	if len(summary.Failed) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(summary.Failed))
+
+	for _, failure := range summary.Failed {
+		errs = append(errs, fmt.Errorf("%s: %w", failure.File.Key, failure.Err))
+	}
+
+	return fmt.Errorf("%d of %d uploads failed: %w",
+		len(summary.Failed), len(summary.Failed)+len(summary.Succeeded), errors.Join(errs...))
+}
+
+// Print reports the totals, each failure was already reported by its upload event.
+func (summary *UploadSummary) Print() {
+	message("uploaded %d files, %d failed", len(summary.Succeeded), len(summary.Failed))
+}
+
+// UploadFiles uploads files using a bounded pool of workers. Every file is attempted,
+// files that were not started before ctx was cancelled are reported as failed.
+func UploadFiles(files []LocalFile, bucket string, options UploadOptions, client S3API, ctx context.Context) *UploadSummary {
+	concurrency := options.Concurrency
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	jobs := make(chan LocalFile)
+	summary := &UploadSummary{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for file := range jobs {
+				err := ctx.Err()
+
+				if err == nil {
+					err = uploadLocalFile(file, bucket, options, client, ctx)
+				} else {
+					emit(&UploadEvent{Key: file.Key, MimeType: file.MimeType, Error: err.Error()})
+				}
+
+				mu.Lock()
+				if err != nil {
+					summary.Failed = append(summary.Failed, UploadFailure{File: file, Err: err})
+				} else {
+					summary.Succeeded = append(summary.Succeeded, file)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		jobs <- file
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return summary
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alrudolph/snyc-static-site-s3/cmd/fakeaws"
+)
+
+// listSite writes files named 0.txt to <count-1>.txt and lists them for upload.
+func listSite(t *testing.T, count int) []LocalFile {
+	t.Helper()
+
+	files := map[string]string{}
+
+	for i := 0; i < count; i++ {
+		files[fmt.Sprintf("%d.txt", i)] = fmt.Sprintf("file %d", i)
+	}
+
+	local, err := ListLocalFiles(writeSite(t, files), "", UploadOptions{Keys: DefaultKeyStrategy()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return local
+}
+
+func failedKeys(summary *UploadSummary) []string {
+	keys := []string{}
+
+	for _, failure := range summary.Failed {
+		keys = append(keys, failure.File.Key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestUploadFilesFailures(t *testing.T) {
+	captureOutput(t)
+
+	files := listSite(t, 20)
+	bucket := fakeaws.NewBucket("site")
+	bucket.FailPuts("3.txt", "11.txt", "17.txt")
+
+	summary := UploadFiles(files, "site", UploadOptions{Concurrency: 4}, bucket, context.Background())
+
+	if len(summary.Succeeded) != 17 || len(summary.Failed) != 3 {
+		t.Errorf("expected 17 uploaded and 3 failed, got %d and %d", len(summary.Succeeded), len(summary.Failed))
+	}
+
+	if keys := failedKeys(summary); fmt.Sprint(keys) != "[11.txt 17.txt 3.txt]" {
+		t.Errorf("expected every failed put to be collected, got %v", keys)
+	}
+
+	if bucket.PutCount() != 17 {
+		t.Errorf("expected 17 stored objects, got %d", bucket.PutCount())
+	}
+
+	if err := summary.Err(); err == nil || !strings.HasPrefix(err.Error(), "3 of 20 uploads failed") {
+		t.Errorf("expected the summary error to count the failures, got %v", err)
+	}
+}
+
+func TestUploadFilesCancelled(t *testing.T) {
+	captureOutput(t)
+
+	files := listSite(t, 5)
+	bucket := fakeaws.NewBucket("site")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a single worker takes the files in order, so only the first one is started
+	bucket.OnPut = func(string) { cancel() }
+
+	summary := UploadFiles(files, "site", UploadOptions{Concurrency: 1}, bucket, ctx)
+
+	if len(summary.Succeeded) != 1 || len(summary.Failed) != 4 {
+		t.Fatalf("expected 1 uploaded and 4 failed, got %d and %d", len(summary.Succeeded), len(summary.Failed))
+	}
+
+	for _, failure := range summary.Failed {
+		if !errors.Is(failure.Err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", failure.File.Key, failure.Err)
+		}
+	}
+
+	if bucket.PutCount() != 1 {
+		t.Errorf("expected no uploads after cancel, got %d puts", bucket.PutCount())
+	}
+}
+
+func TestUploadFilesSummaryPrint(t *testing.T) {
+	output := captureOutput(t)
+
+	summary := &UploadSummary{
+		Succeeded: []LocalFile{{Key: "a"}, {Key: "b"}},
+		Failed:    []UploadFailure{{File: LocalFile{Key: "c"}, Err: errors.New("denied")}},
+	}
+	summary.Print()
+
+	if got := output.String(); got != "> uploaded 2 files, 1 failed\n" {
+		t.Errorf("expected the totals, got %q", got)
+	}
+}
@@ -3,6 +3,10 @@ package main
 import (
 	"github.com/alrudolph/snyc-static-site-s3/cmd"
 	_ "github.com/alrudolph/snyc-static-site-s3/cmd/config"
+	_ "github.com/alrudolph/snyc-static-site-s3/cmd/diff"
+	_ "github.com/alrudolph/snyc-static-site-s3/cmd/history"
+	_ "github.com/alrudolph/snyc-static-site-s3/cmd/pull"
+	_ "github.com/alrudolph/snyc-static-site-s3/cmd/rollback"
 	_ "github.com/alrudolph/snyc-static-site-s3/cmd/setup"
 )
 